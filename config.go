@@ -0,0 +1,326 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"dump-handler/logic"
+	"dump-handler/pkg/compress"
+	"dump-handler/pkg/config"
+	"dump-handler/pkg/secrets"
+	"dump-handler/pkg/watch"
+	"dump-handler/thirdparty/prom"
+	"dump-handler/thirdparty/storage"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// EnvPrefix 环境变量前缀，参数名大写、-换成_，如 DUMP_HANDLER_PART_SIZE 对应 -part-size
+const EnvPrefix = "DUMP_HANDLER_"
+
+// Config 配置文件的结构，带flag tag的字段与同名的命令行参数等价。示例(YAML):
+//
+//	ka: retail
+//	env: prod
+//	prom:
+//	  addr: 10.150.30.6:9090
+//	storage:
+//	  target: s3://dumps?endpoint=http://minio:9000&path_style=true
+//	  compress: zstd
+//	notify:
+//	  dingtalk:
+//	    webhook: https://oapi.dingtalk.com/robot/send?access_token=xxx
+//	    at: ["13800000000"]
+type Config struct {
+	Ka       string `json:"ka" flag:"ka"`
+	Env      string `json:"env" flag:"e"`
+	Pod      string `json:"pod" flag:"k"`
+	DumpPath string `json:"dump_path" flag:"filepath"`
+	SpoolDir string `json:"spool_dir" flag:"spool-dir"`
+	LogLevel string `json:"log_level" flag:"log-level"`
+
+	PodName struct {
+		TeamSegments int      `json:"team_segments" flag:"team-segments"`
+		Teams        []string `json:"teams" flag:"teams"`
+	} `json:"pod_name"`
+
+	Watch struct {
+		Dir         string   `json:"dir" flag:"watch-dir"`
+		Patterns    []string `json:"patterns" flag:"watch-patterns"`
+		Interval    string   `json:"interval" flag:"watch-interval"`
+		Inotify     bool     `json:"inotify" flag:"watch-inotify"`
+		After       string   `json:"after" flag:"watch-after"`
+		MaxAttempts int      `json:"max_attempts" flag:"watch-max-attempts"`
+	} `json:"watch"`
+
+	Node struct {
+		KubeletDir string `json:"kubelet_dir" flag:"kubelet-dir"`
+		Name       string `json:"name" flag:"node-name"`
+		EnvVar     string `json:"env_var" flag:"env-var"`
+	} `json:"node"`
+
+	Artifacts struct {
+		Globs   []string `json:"globs" flag:"artifacts"`
+		MaxSize int64    `json:"max_size" flag:"artifact-max-size"`
+		MaxAge  string   `json:"max_age" flag:"artifact-max-age"`
+	} `json:"artifacts"`
+
+	Threads struct {
+		Count       int    `json:"count" flag:"thread-dump-count"`
+		Interval    string `json:"interval" flag:"thread-dump-interval"`
+		Output      string `json:"output" flag:"thread-dump-output"`
+		Timeout     string `json:"timeout" flag:"thread-dump-timeout"`
+		Jcmd        string `json:"jcmd" flag:"jcmd"`
+		KeyTemplate string `json:"key_template" flag:"thread-key-template"`
+	} `json:"threads"`
+
+	Core struct {
+		KeyTemplate string `json:"key_template" flag:"core-key-template"`
+		Compress    string `json:"compress" flag:"core-compress"`
+	} `json:"core"`
+
+	K8s struct {
+		API            bool     `json:"api" flag:"k8s-api"`
+		Namespace      string   `json:"namespace" flag:"namespace"`
+		DownwardAPIDir string   `json:"downward_api_dir" flag:"downward-api-dir"`
+		Container      string   `json:"container" flag:"container"`
+		AlertPodLabels []string `json:"alert_pod_labels" flag:"alert-pod-labels"`
+	} `json:"k8s"`
+
+	Prom struct {
+		Addr         string `json:"addr" flag:"prom"`
+		FlushTimeout string `json:"flush_timeout" flag:"flush-timeout"`
+		// 配置后代替addr，可以写入多个普罗并设置重试策略
+		RemoteWrite []prom.RemoteConfig `json:"remote_write"`
+	} `json:"prom"`
+
+	Storage struct {
+		Target            string   `json:"target" flag:"target"`
+		CosURL            string   `json:"cos_url" flag:"cosurl"`
+		SecretID          string   `json:"secret_id" flag:"secret"`
+		SecretKey         string   `json:"secret_key" flag:"secretkey"`
+		SecretIDFile      string   `json:"secret_id_file" flag:"secret-file"`
+		SecretKeyFile     string   `json:"secret_key_file" flag:"secretkey-file"`
+		CredentialsFile   string   `json:"credentials_file" flag:"credentials-file"`
+		SecretsDir        string   `json:"secrets_dir" flag:"secrets-dir"`
+		PartSize          int64    `json:"part_size" flag:"part-size"`
+		PartWorkers       int      `json:"part_workers" flag:"part-workers"`
+		AbortOrphansAfter string   `json:"abort_orphans_after" flag:"abort-orphans-after"`
+		Compress          string   `json:"compress" flag:"compress"`
+		CompressLevel     int      `json:"compress_level" flag:"compress-level"`
+		KeyTemplate       string   `json:"key_template" flag:"key-template"`
+		Retention         string   `json:"retention" flag:"retention"`
+		AllowedBuckets    []string `json:"allowed_buckets" flag:"allowed-buckets"`
+	} `json:"storage"`
+
+	Stable struct {
+		Interval      string `json:"interval" flag:"stable-interval"`
+		Checks        int    `json:"checks" flag:"stable-checks"`
+		Timeout       string `json:"timeout" flag:"stable-timeout"`
+		ValidateHprof bool   `json:"validate_hprof" flag:"validate-hprof"`
+	} `json:"stable"`
+
+	Encryption struct {
+		KeyFile  string `json:"key_file" flag:"encrypt-key-file"`
+		KMSURL   string `json:"kms_url" flag:"kms-url"`
+		KMSKeyID string `json:"kms_key_id" flag:"kms-key-id"`
+		KMSToken string `json:"kms_token" flag:"kms-token"`
+	} `json:"encryption"`
+
+	// 按pod名解析出的项目组、app以及env、ka选择存储、对象名和通知渠道，都不匹配时使用默认路由
+	Routes   []*logic.Route                 `json:"routes"`
+	Channels map[string]logic.ChannelConfig `json:"channels"`
+
+	Notify struct {
+		TemplateFile string `json:"template_file" flag:"template-file"`
+		LinkExpire   string `json:"link_expire" flag:"link-expire"`
+		Timeout      string `json:"timeout" flag:"notify-timeout"`
+		DingTalk     struct {
+			Webhook string   `json:"webhook" flag:"dingtalk-webhook"`
+			Secret  string   `json:"secret" flag:"dingtalk-secret"`
+			At      []string `json:"at" flag:"dingtalk-at"`
+		} `json:"dingtalk"`
+		WeCom struct {
+			Webhook string `json:"webhook" flag:"wecom-webhook"`
+		} `json:"wecom"`
+		Feishu struct {
+			Webhook string `json:"webhook" flag:"feishu-webhook"`
+			Secret  string `json:"secret" flag:"feishu-secret"`
+		} `json:"feishu"`
+		Slack struct {
+			Webhook string `json:"webhook" flag:"slack-webhook"`
+		} `json:"slack"`
+		Webhook struct {
+			URL     string            `json:"url" flag:"webhook-url"`
+			Headers map[string]string `json:"headers"`
+		} `json:"webhook"`
+		Alertmanager struct {
+			URLs      []string `json:"urls" flag:"alertmanager-url"`
+			EndsAfter string   `json:"ends_after" flag:"alert-ends-after"`
+		} `json:"alertmanager"`
+	} `json:"notify"`
+}
+
+var (
+	configFile string //配置文件
+	fileConfig Config //配置文件中没有对应命令行参数的部分
+)
+
+// parseFlags 解析命令行，再依次叠加配置文件和环境变量，命令行指定的参数不会被覆盖
+func parseFlags(args []string) []error {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return []error{err}
+	}
+	explicit := config.Explicit(flag.CommandLine)
+	if configFile == "" {
+		configFile = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	var errs []error
+	if configFile != "" {
+		m, err := config.Load(configFile)
+		if err != nil {
+			return []error{err}
+		}
+		errs = append(errs, config.ApplyFlags(flag.CommandLine, &Config{}, m, explicit)...)
+		if err := config.Decode(m, &fileConfig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return append(errs, config.ApplyEnv(flag.CommandLine, EnvPrefix, explicit)...)
+}
+
+func checkURL(name, raw string, errs *[]error) {
+	if raw == "" {
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		*errs = append(*errs, fmt.Errorf("%s: invalid url %q", name, raw))
+	}
+}
+
+// validate 检查最终生效的配置，返回全部错误
+func validate() []error {
+	var errs []error
+	if ka == "" {
+		errs = append(errs, fmt.Errorf("ka is required"))
+	}
+	if env == "" {
+		errs = append(errs, fmt.Errorf("env is required"))
+	}
+	if locaFilename == "" {
+		errs = append(errs, fmt.Errorf("dump path is required"))
+	}
+	st, err := storageTarget()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("storage target: %v", err))
+	} else if u, err := url.Parse(st); err != nil {
+		errs = append(errs, fmt.Errorf("storage target: %v", err))
+	} else if !strings.Contains(","+strings.Join(storage.Schemes(), ",")+",", ","+u.Scheme+",") {
+		errs = append(errs, fmt.Errorf("storage target: unsupported scheme %q, supported: %s", u.Scheme, strings.Join(storage.Schemes(), ", ")))
+	}
+	if u, err := url.Parse(st); err == nil && u.Scheme != "file" {
+		if _, err := credential(); err != nil {
+			errs = append(errs, fmt.Errorf("storage credential: %v", err))
+		}
+	}
+	switch strings.ToUpper(logLevel) {
+	case "DEBUG", "INFO", "WARNING", "ERROR", "FATAL":
+	default:
+		errs = append(errs, fmt.Errorf("log-level: unknown level %q", logLevel))
+	}
+	if partSize < storage.MinPartSize {
+		errs = append(errs, fmt.Errorf("part-size must be at least %d (5MiB), smaller parts are rejected by S3 when the upload completes", storage.MinPartSize))
+	}
+	if partWorkers <= 0 {
+		errs = append(errs, fmt.Errorf("part-workers must be positive"))
+	}
+	if _, err := compress.Parse(codec); err != nil {
+		errs = append(errs, fmt.Errorf("compress: %v", err))
+	}
+	if _, err := compress.Parse(coreCompress); err != nil {
+		errs = append(errs, fmt.Errorf("core-compress: %v", err))
+	}
+	if _, err := logic.ParseKeyTemplate(coreKeyTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("core-key-template: %v", err))
+	}
+	if stableOpts.Checks <= 0 || stableOpts.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("stable-checks and stable-interval must be positive"))
+	}
+	if watchAfter != watch.AfterRename && watchAfter != watch.AfterDelete {
+		errs = append(errs, fmt.Errorf("watch-after must be %s or %s", watch.AfterRename, watch.AfterDelete))
+	}
+	if watchInterval <= 0 {
+		errs = append(errs, fmt.Errorf("watch-interval must be positive"))
+	}
+	if artifactMaxSize < 0 || artifactMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("artifact-max-size and artifact-max-age must not be negative"))
+	}
+	if threadDumpCount <= 0 || threadDumpTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("thread-dump-count and thread-dump-timeout must be positive"))
+	}
+	if _, err := logic.ParseKeyTemplate(threadKeyTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("thread-key-template: %v", err))
+	}
+	if retention < 0 {
+		errs = append(errs, fmt.Errorf("retention must not be negative"))
+	}
+	if teamSegments <= 0 {
+		errs = append(errs, fmt.Errorf("team-segments must be positive"))
+	}
+	if _, err := keyWrapper(); err != nil {
+		errs = append(errs, fmt.Errorf("encryption: %v", err))
+	}
+	if kmsUrl != "" && kmsKeyID == "" {
+		errs = append(errs, fmt.Errorf("encryption: kms-key-id is required with kms-url"))
+	}
+	checkURL("kms-url", kmsUrl, &errs)
+	for _, rc := range promRemoteWrite() {
+		checkURL("prom remote_write "+rc.Name, rc.Url, &errs)
+	}
+	checkURL("dingtalk-webhook", dingWebhook, &errs)
+	checkURL("wecom-webhook", wecomWebhook, &errs)
+	checkURL("feishu-webhook", feishuWebhook, &errs)
+	checkURL("slack-webhook", slackWebhook, &errs)
+	checkURL("webhook-url", webhookUrl, &errs)
+	for _, u := range splitList(alertmanagerUrl) {
+		checkURL("alertmanager-url", u, &errs)
+	}
+	if _, err := logic.LoadTemplates(templateFile); err != nil {
+		errs = append(errs, fmt.Errorf("template-file: %v", err))
+	}
+	if _, rerrs := routeTable(); len(rerrs) > 0 {
+		errs = append(errs, rerrs...)
+	}
+	for _, r := range fileConfig.Routes {
+		if r.Target != "" {
+			if _, err := url.Parse(r.Target); err != nil {
+				errs = append(errs, fmt.Errorf("route %s: target: %v", r.Name, err))
+			}
+		}
+	}
+	for name, c := range fileConfig.Channels {
+		checkURL("channel "+name, c.Webhook, &errs)
+	}
+	return errs
+}
+
+// configValidate 子命令: dump-handler config validate -config <文件>
+func configValidate(args []string) int {
+	errs := parseFlags(args)
+	secrets.RedactLogs(strings.ToUpper(logLevel))
+	registerSecrets()
+	errs = append(errs, validate()...)
+	if len(errs) == 0 {
+		fmt.Println("config ok")
+		return 0
+	}
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, secrets.RedactString(err.Error()))
+	}
+	logger.Errorf("config has %d errors\n", len(errs))
+	return 1
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"dump-handler/logic"
+	"dump-handler/pkg/cgroup"
+	"dump-handler/pkg/secrets"
+	"dump-handler/thirdparty/k8s"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// DefaultCoreConfig core_pattern启动的进程没有环境变量，-config和DUMP_HANDLER_CONFIG都没有时读取该文件
+const DefaultCoreConfig = "/etc/dump-handler/config.yaml"
+
+// countingReader 记录读到的字节数，即core的原始大小
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// corePod 从API server按UID查pod，需要-k8s-api，在主机上运行时通常取不到
+func corePod(uid string) *k8s.Pod {
+	if !k8sAPI {
+		return nil
+	}
+	c, err := k8s.InClusterClient()
+	if err != nil {
+		logger.Warningf("[core][k8s][err:%v]", err)
+		return nil
+	}
+	node := nodeName
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pod, err := k8s.NewNodePods(c, node, 0).Get(ctx, uid)
+	if err != nil {
+		logger.Warningf("[core][pod_uid:%s][err:%v]", uid, err)
+	}
+	return pod
+}
+
+// coreDump 按崩溃进程的cgroup找到所在的pod，依次取API server、进程的HOSTNAME、kubelet生成的hosts文件；
+// 不在pod中的进程用主机名
+func coreDump(pid int) dump {
+	d := dump{env: env}
+	environ, err := cgroup.Environ(pid)
+	if err != nil {
+		logger.Warningf("[core][pid:%d][environ][err:%v]", pid, err)
+	}
+	if v := environ[envVar]; v != "" {
+		d.env = v
+	}
+	cg, err := cgroup.ForPID(pid)
+	if err != nil {
+		logger.Warningf("[core][pid:%d][cgroup][err:%v]", pid, err)
+	}
+	if cg.PodUID == "" {
+		d.pod, _ = os.Hostname()
+		return d
+	}
+	if pod := corePod(cg.PodUID); pod != nil {
+		d.pod = pod.Metadata.Name
+		d.meta = logic.NewPodMeta(pod, pod.ContainerName(cg.ContainerID), "api")
+	}
+	if d.pod == "" {
+		d.pod = environ["HOSTNAME"]
+	}
+	if d.pod == "" {
+		d.pod = k8s.EtcHostsName(kubeletDir, cg.PodUID)
+	}
+	if d.pod == "" {
+		d.pod = cg.PodUID
+	}
+	return d
+}
+
+// 内核在进程崩溃时启动，从stdin读取core并流式上传:
+// echo '|/usr/local/bin/dump-handler core %P %e %s %t' > /proc/sys/kernel/core_pattern
+func core(args []string) error {
+	if len(args) != 4 {
+		return fmt.Errorf("usage: dump-handler core [flags] %%P %%e %%s %%t, got %v", args)
+	}
+	pid, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("pid %q: %v", args[0], err)
+	}
+	exe := args[1]
+	sig, err := strconv.Atoi(args[2])
+	if err != nil {
+		return fmt.Errorf("signal %q: %v", args[2], err)
+	}
+	ts, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return fmt.Errorf("time %q: %v", args[3], err)
+	}
+	t, err := logic.ParseKeyTemplate(coreKeyTemplate)
+	if err != nil {
+		io.Copy(ioutil.Discard, os.Stdin)
+		return fmt.Errorf("core-key-template: %v", err)
+	}
+	d := coreDump(pid)
+	logger.Infof("[core][pid:%d][exe:%s][signal:%s][pod:%s][env:%s]", pid, exe, logic.SignalName(sig), d.pod, d.env)
+	u, err := prepare(d, coreCompress, time.Unix(ts, 0))
+	if u == nil || err != nil {
+		// 注解禁用了上传或配置有误时也读完core再退出，内核写管道不会出错
+		io.Copy(ioutil.Discard, os.Stdin)
+		return err
+	}
+	u.info.Exe = exe
+	u.exe, u.signal = exe, logic.SignalName(sig)
+	fileName, err := logic.RenderKey(t, u.info)
+	if err != nil {
+		io.Copy(ioutil.Discard, os.Stdin)
+		return fmt.Errorf("render object key: %v", err)
+	}
+	src := &countingReader{r: os.Stdin}
+	key, err := logic.UploadStream(context.Background(), u.backend, fileName, src, u.opts)
+	if err != nil {
+		// core只能从管道读一次，不能进入spool重放，发送上传失败的告警
+		io.Copy(ioutil.Discard, src)
+		alarm(logic.NewCoreFailedAlarm(u.backend.URL(), fileName, u.info.Ka, d.env, u.signal, u.exe, secrets.RedactString(err.Error())))
+		return fmt.Errorf("upload core: %v", err)
+	}
+	u.finish(key, src.n, nil)
+	return nil
+}
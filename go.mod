@@ -3,9 +3,10 @@ module dump-handler
 go 1.16
 
 require (
-	github.com/aliyun/aliyun-oss-go-sdk v2.2.5+incompatible
+	github.com/aliyun/aliyun-oss-go-sdk v3.0.2+incompatible
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/snappy v0.0.2
+	github.com/klauspost/compress v1.13.6
 	github.com/opentracing-contrib/go-stdlib v1.0.0
 	github.com/opentracing/opentracing-go v1.2.0
 	github.com/pkg/errors v0.9.1
@@ -14,4 +15,5 @@ require (
 	github.com/tencentyun/cos-go-sdk-v5 v0.7.38
 	github.com/toolkits/pkg v1.3.0
 	go.uber.org/atomic v1.7.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dump-handler/logic"
+	"dump-handler/pkg/compress"
+	"dump-handler/pkg/dumpfile"
+	"dump-handler/pkg/podname"
+	"dump-handler/thirdparty/prom"
+	"dump-handler/thirdparty/storage"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// dump 一个待处理的dump文件及其所属的pod
+type dump struct {
+	path string
+	pod  string         // pod名
+	env  string         // 部署环境
+	meta *logic.PodMeta // 没有pod信息时为nil
+}
+
+// localDump 本pod的dump，单次执行和watch模式使用
+func localDump(path string) dump {
+	return dump{path: path, pod: podId, env: env, meta: podMeta()}
+}
+
+// upload 一次上传用到的路由、存储和参数
+type upload struct {
+	d           dump
+	pod         podname.Info
+	info        logic.RouteInfo
+	rt          *logic.RouteTable
+	route       *logic.Route
+	ov          logic.Overrides
+	target      string
+	backend     storage.Backend
+	opts        logic.UploadOptions
+	retainUntil *time.Time
+	// core dump、线程dump时填充，决定告警和通知的类型
+	exe, signal string
+	samples     int
+	summary     string // hprof文件头摘要
+}
+
+// prepare 解析pod名、匹配路由、应用pod注解，codec为注解没有指定时的压缩算法；
+// 返回nil表示注解禁用了上传
+func prepare(d dump, codec string, now time.Time) (*upload, error) {
+	rt, errs := routeTable()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("load routes: %v", errs)
+	}
+	u := &upload{d: d, rt: rt, pod: podParser().Parse(d.pod)}
+	if d.meta != nil {
+		if w, k := d.meta.Workload(); w != "" {
+			u.pod = podParser().WithWorkload(u.pod, w, k)
+		}
+		var errs []error
+		u.ov, errs = logic.ParseOverrides(d.meta.Annotations)
+		for _, err := range errs {
+			logger.Warningf("[annotation][pod:%s][err:%v]", d.pod, err)
+		}
+		if u.ov.Disable {
+			logger.Infof("[annotation][pod:%s] upload disabled by %s", d.pod, logic.AnnotationDisable)
+			return nil, nil
+		}
+	}
+	u.info = logic.NewRouteInfo(u.pod, ka, d.env, now)
+	u.route = rt.Match(u.info)
+	logger.Infof("[route][name:%s][team:%s][app:%s][workload:%s][kind:%s]", u.route.Name, u.info.Team, u.info.App, u.info.Workload, u.info.Kind)
+
+	var err error
+	u.target = u.route.Target
+	if u.target == "" {
+		if u.target, err = storageTarget(); err != nil {
+			return nil, fmt.Errorf("init storage backend: %v", err)
+		}
+	}
+	if u.ov.Bucket != "" {
+		if t, err := annotationTarget(u.target, u.ov.Bucket); err != nil {
+			logger.Warningf("[annotation][pod:%s][bucket:%s][err:%v]", d.pod, u.ov.Bucket, err)
+		} else {
+			u.target = t
+		}
+	}
+	if u.backend, err = backendFor(u.target); err != nil {
+		return nil, fmt.Errorf("init storage backend: %v", err)
+	}
+	c, err := compress.Parse(codec)
+	if err != nil {
+		return nil, fmt.Errorf("parse compress codec: %v", err)
+	}
+	if u.ov.Compress != "" {
+		c = u.ov.Compress
+	}
+	kw, err := keyWrapper()
+	if err != nil {
+		return nil, fmt.Errorf("load master key: %v", err)
+	}
+	u.opts = logic.UploadOptions{PartSize: partSize, Workers: partWorkers, Codec: c, CompressLevel: level, Encryption: kw}
+	u.opts.Metadata = map[string]string{}
+	if d.meta != nil {
+		u.opts.Metadata = d.meta.ObjectMetadata()
+	}
+	keep := retention
+	if u.ov.Retention > 0 {
+		keep = u.ov.Retention
+	}
+	if keep > 0 {
+		t := now.Add(keep).UTC().Truncate(time.Second)
+		u.retainUntil = &t
+		u.opts.Metadata[logic.RetainUntilMeta] = t.Format(time.RFC3339)
+	}
+	return u, nil
+}
+
+// finish 上传成功后上传清单、清理残留的分片上传，再发送通知和普罗告警，失败只记日志；
+// arts为已上传的附属文件
+func (u *upload) finish(key string, size int64, arts []logic.Artifact) {
+	alarm(u.report(key, size, arts))
+}
+
+// report finish中除普罗告警外的部分，返回要发送的告警，drain重放时由spool批量发送
+func (u *upload) report(key string, size int64, arts []logic.Artifact) prom.MetricPoint {
+	backend, ka := u.backend, u.info.Ka
+	if u.d.meta != nil {
+		m := logic.DumpManifest{Key: key, Size: size, Uploaded: time.Now(), Ka: ka, Env: u.d.env, Pod: u.d.meta, RetainUntil: u.retainUntil, Artifacts: arts}
+		if err := logic.UploadManifest(context.Background(), backend, m); err != nil {
+			logger.Warningf("[pod_meta][manifest][key:%s][err:%v]", key+logic.ManifestSuffix, err)
+		}
+	}
+	logic.AbortKeyUploads(context.Background(), backend, key)
+	ns, err := notifiers()
+	if err != nil {
+		logger.Errorf("load notifiers error![%v]\n", err)
+	}
+	if rns := u.rt.Notifiers(u.route); len(rns) > 0 {
+		ns = rns
+	}
+	if u.ov.Notify != nil {
+		var missing []string
+		if ns, missing = u.rt.Channels(u.ov.Notify); len(missing) > 0 {
+			logger.Warningf("[annotation][pod:%s][unknown channels:%v]", u.d.pod, missing)
+		}
+	}
+	if len(ns) > 0 {
+		ev := logic.NewOOMDumpEvent(context.Background(), backend, key, size, u.pod, ka, u.d.env, linkExpire).WithPodMeta(u.d.meta, splitList(alertPodLabels)).
+			WithArtifacts(context.Background(), backend, arts, linkExpire)
+		ev.Exe, ev.Signal, ev.Samples, ev.Summary = u.exe, u.signal, u.samples, u.summary
+		logic.NotifyAll(context.Background(), ns, ev, notifyTimeout)
+	}
+	point := logic.NewAlarm(backend.URL(), key, ka, u.d.env)
+	switch {
+	case u.signal != "":
+		point = logic.NewCoreAlarm(backend.URL(), key, ka, u.d.env, u.signal, u.exe)
+	case u.samples > 0:
+		point = logic.NewThreadDumpAlarm(backend.URL(), key, ka, u.d.env, u.samples)
+	}
+	if len(arts) > 0 {
+		point.TagsMap["artifacts"] = logic.ArtifactNames(arts)
+	}
+	return point
+}
+
+// drainFinish drain上传成功后按spool中记录的pod重新匹配路由，走与直接上传相同的清单、通知；
+// 失败时只生成普罗告警
+func drainFinish(ctx context.Context, job logic.UploadJob, backend storage.Backend, key string, size int64) prom.MetricPoint {
+	u, err := prepare(dump{pod: job.Pod, env: job.Env, meta: job.PodMeta}, codec, time.Now())
+	if u == nil || err != nil {
+		logger.Warningf("[spool][finish][key:%s][err:%v]", key, err)
+		return logic.NewAlarm(backend.URL(), key, job.Ka, job.Env)
+	}
+	// 对象已经上传到任务记录的地址，保留时间以上传时写入的元数据为准
+	u.info.Ka, u.backend, u.retainUntil = job.Ka, backend, nil
+	if t, err := time.Parse(time.RFC3339, job.Metadata[logic.RetainUntilMeta]); err == nil {
+		u.retainUntil = &t
+	}
+	return u.report(key, size, nil)
+}
+
+// handleDump 等待dump写完后上传，再发送通知和普罗告警。
+// 返回错误表示dump没有上传也没有进入spool，需要重试；上传之后的通知、告警失败只记日志
+func handleDump(d dump) error {
+	fi, err := dumpfile.WaitStable(context.Background(), d.path, stableOpts)
+	if err != nil {
+		return fmt.Errorf("dump file not complete: %v", err)
+	}
+	u, err := prepare(d, codec, time.Now())
+	if u == nil || err != nil {
+		return err
+	}
+	fileName, err := u.route.Key(u.info)
+	if err != nil {
+		return fmt.Errorf("render object key: %v", err)
+	}
+	if h, err := dumpfile.ReadHprofHeader(d.path); err == nil {
+		u.summary = logic.HprofSummary(h, stableOpts.Validate)
+	}
+	key, err := logic.UploadDump(context.Background(), u.backend, fileName, d.path, u.opts)
+	if err != nil {
+		if spoolUpload(u.target, fileName, d, u.opts) {
+			logger.Errorf("upload file error, spooled![%v]\n", err)
+			return nil
+		}
+		return fmt.Errorf("upload file: %v", err)
+	}
+	// 只取dump前后-artifact-max-age内修改的文件，不带上以前事故的残留
+	var since time.Time
+	if artifactMaxAge > 0 {
+		since = fi.ModTime().Add(-artifactMaxAge)
+	}
+	paths := logic.FindArtifacts(d.path, splitList(artifactGlobs), since)
+	arts := logic.UploadArtifacts(context.Background(), u.backend, key, paths, artifactMaxSize, u.opts)
+	u.finish(key, fi.Size(), arts)
+	return nil
+}
+
+// alarm 发送告警并等待发送完成，失败时保存到spool目录
+func alarm(point prom.MetricPoint) {
+	pd, err := newPromDataSource()
+	if err != nil {
+		logger.Errorf("init prom datasource error![%v]\n", err)
+		spoolAlarm(point)
+		return
+	}
+	if pd == nil {
+		return
+	}
+	if err := logic.SendAlarm(pd, point); err != nil {
+		logger.Errorf("send alarm to prom failed,[%v]\n", err)
+		spoolAlarm(point)
+		return
+	}
+	if err := logic.FlushAlarm(pd, flushTimeout); err != nil {
+		logger.Errorf("flush alarm to prom failed,[%v]\n", err)
+		spoolAlarm(point)
+	}
+}
@@ -23,19 +23,47 @@ func newOOMDumpTags(cosUrl, fileName, ka, env string) map[string]string {
 	}
 }
 
-func AlarmToProm(pd *prom.DataSource, cosUrl, fileName, ka, env string) error {
-	tags := newOOMDumpTags(cosUrl, fileName, ka, env)
-
-	alarm := prom.NewMetricPoint(
+// NewAlarm dump上传成功的告警
+func NewAlarm(cosUrl, fileName, ka, env string) prom.MetricPoint {
+	return *prom.NewMetricPoint(
 		BIZ_OOM_DUMP,
-		tags,
+		newOOMDumpTags(cosUrl, fileName, ka, env),
 		time.Now().Unix(),
 		float64(1))
+}
+
+func AlarmToProm(pd *prom.DataSource, cosUrl, fileName, ka, env string) error {
+	return SendAlarm(pd, NewAlarm(cosUrl, fileName, ka, env))
+}
 
+// SendAlarm 写入告警，NewAlarm、NewCoreAlarm生成的都可以
+func SendAlarm(pd *prom.DataSource, alarm prom.MetricPoint) error {
 	if err := pd.RemoteWrite([]prom.MetricPoint{
-		*alarm,
+		alarm,
 	}); err != nil {
 		logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// FlushAlarm 退出前等待告警发送到所有remote write目标，任一目标失败都返回错误
+func FlushAlarm(pd *prom.DataSource, timeout time.Duration) error {
+	results, err := pd.Close(timeout)
+	failed := 0
+	for _, r := range results {
+		if r.OK() {
+			logger.Infof("[flush_alarm][target:%s][url:%s][sent:%d]", r.Name, r.Url, r.Sent)
+			continue
+		}
+		failed++
+		logger.Errorf("[flush_alarm][target:%s][url:%s][sent:%d][failed:%d][err:%v]", r.Name, r.Url, r.Sent, r.Failed, r.LastErr)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("alarm not delivered to %d/%d remote write targets", failed, len(results))
 	}
 	return nil
 }
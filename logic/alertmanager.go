@@ -0,0 +1,99 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dump-handler/thirdparty/alertmanager"
+)
+
+const (
+	AlertName           = "JvmOOMDump"
+	CoreAlertName       = "CoreDump"
+	ThreadDumpAlertName = "JvmThreadDump"
+)
+
+func alertName(e OOMDumpEvent) string {
+	if e.Signal != "" {
+		return CoreAlertName
+	}
+	if e.Samples > 0 {
+		return ThreadDumpAlertName
+	}
+	return AlertName
+}
+
+// AlertmanagerNotifier 直接向Alertmanager发送告警，不需要在普罗里配置告警规则
+type AlertmanagerNotifier struct {
+	Client    *alertmanager.Client
+	EndsAfter time.Duration // 告警在多久后自动恢复，0时由Alertmanager的resolve_timeout决定
+	Templates *Templates    // 注解summary、description的模板，nil时使用内置模板
+}
+
+func (n AlertmanagerNotifier) Name() string { return "alertmanager" }
+
+// NewAlert OOMDumpEvent对应的告警
+func (n AlertmanagerNotifier) NewAlert(e OOMDumpEvent) (alertmanager.Alert, error) {
+	summary, err := n.Templates.Render(n.Name(), "summary", e)
+	if err != nil {
+		return alertmanager.Alert{}, err
+	}
+	description, err := n.Templates.Render(n.Name(), "description", e)
+	if err != nil {
+		return alertmanager.Alert{}, err
+	}
+	// 线程dump多为主动抓取，不需要按critical处理
+	severity := "critical"
+	if e.Samples > 0 {
+		severity = "warning"
+	}
+	now := time.Now()
+	labels := map[string]string{}
+	for k, v := range e.Labels {
+		labels[k] = v
+	}
+	a := alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": alertName(e),
+			"severity":  severity,
+			"ka":        e.Ka,
+			"env":       e.Env,
+			"pod":       e.Pod,
+			"workload":  e.Workload,
+			"kind":      e.Kind,
+			"app":       e.App,
+			"team":      e.Team,
+		},
+		Annotations: map[string]string{
+			"summary":     summary,
+			"description": description,
+			"dump_link":   e.Link,
+			"dump_size":   fmt.Sprintf("%d", e.Size),
+		},
+		StartsAt: now,
+	}
+	// 内置标签优先
+	for k, v := range a.Labels {
+		labels[k] = v
+	}
+	a.Labels = labels
+	if e.Signal != "" {
+		a.Labels["signal"], a.Labels["exe"] = e.Signal, e.Exe
+	}
+	if len(e.Artifacts) > 0 {
+		a.Annotations["artifacts"] = ArtifactNames(e.Artifacts)
+	}
+	if n.EndsAfter > 0 {
+		a.EndsAt = now.Add(n.EndsAfter)
+	}
+	return a, nil
+}
+
+func (n AlertmanagerNotifier) Notify(ctx context.Context, e OOMDumpEvent) error {
+	a, err := n.NewAlert(e)
+	if err != nil {
+		return err
+	}
+	return n.Client.Post(ctx, []alertmanager.Alert{a})
+}
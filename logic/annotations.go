@@ -0,0 +1,147 @@
+package logic
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dump-handler/pkg/compress"
+)
+
+// AnnotationPrefix pod注解的前缀，如 dump-handler.io/compress: zstd
+const AnnotationPrefix = "dump-handler.io/"
+
+// 支持的注解
+const (
+	AnnotationDisable   = AnnotationPrefix + "disable"   // "true"时不上传
+	AnnotationBucket    = AnnotationPrefix + "bucket"    // 存储桶名，替换配置的存储地址中的桶
+	AnnotationRetention = AnnotationPrefix + "retention" // 保留时长，如 72h、30d
+	AnnotationNotify    = AnnotationPrefix + "notify"    // channels中的渠道名，逗号分隔，none表示不通知
+	AnnotationCompress  = AnnotationPrefix + "compress"  // none、gzip、zstd
+)
+
+// 桶名只允许小写字母、数字和"-"，不能是完整地址，注解不能改变scheme和endpoint
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// RetainUntilMeta 对象元数据中的过期时间，RFC3339，prune子命令据此删除
+const RetainUntilMeta = "retain-until"
+
+// Overrides pod注解对路由、压缩、通知和上传参数的覆盖，零值表示不覆盖
+type Overrides struct {
+	Disable   bool
+	Bucket    string
+	Retention time.Duration
+	Notify    []string // 非nil时代替路由的通知渠道，空表示不通知
+	Compress  compress.Codec
+}
+
+// ParseRetention 支持Go的时间格式和以d结尾的天数
+func ParseRetention(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if strings.HasSuffix(s, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(s, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid retention %q, e.g. 72h or 30d", s)
+	}
+	return d, nil
+}
+
+// ParseOverrides 解析dump-handler.io/前缀的注解，不合法的注解忽略并返回错误
+func ParseOverrides(annotations map[string]string) (Overrides, []error) {
+	var o Overrides
+	var errs []error
+	for k, v := range annotations {
+		if !strings.HasPrefix(k, AnnotationPrefix) {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case AnnotationDisable:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", k, err))
+				continue
+			}
+			o.Disable = b
+		case AnnotationBucket:
+			if !bucketName.MatchString(v) {
+				errs = append(errs, fmt.Errorf("%s: %q is not a bucket name", k, v))
+				continue
+			}
+			o.Bucket = v
+		case AnnotationRetention:
+			d, err := ParseRetention(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", k, err))
+				continue
+			}
+			o.Retention = d
+		case AnnotationNotify:
+			o.Notify = []string{}
+			if v == "none" {
+				continue
+			}
+			for _, n := range strings.Split(v, ",") {
+				if n = strings.TrimSpace(n); n != "" {
+					o.Notify = append(o.Notify, n)
+				}
+			}
+		case AnnotationCompress:
+			c, err := compress.Parse(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", k, err))
+				continue
+			}
+			o.Compress = c
+		default:
+			errs = append(errs, fmt.Errorf("unknown annotation %s", k))
+		}
+	}
+	return o, errs
+}
+
+// BucketName 存储地址中的桶名
+func BucketName(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "s3":
+		return u.Host, nil
+	case "oss":
+		if u.Query().Get("endpoint") != "" {
+			return u.Host, nil
+		}
+		fallthrough
+	case "cos":
+		// <bucket>.cos.<region>.myqcloud.com、<bucket>.<endpoint>
+		if i := strings.Index(u.Host, "."); i > 0 {
+			return u.Host[:i], nil
+		}
+	}
+	return "", fmt.Errorf("%s: bucket name not supported for scheme %q", target, u.Scheme)
+}
+
+// WithBucket 替换存储地址中的桶名，scheme、endpoint和参数不变
+func WithBucket(target, bucket string) (string, error) {
+	if !bucketName.MatchString(bucket) {
+		return "", fmt.Errorf("%q is not a bucket name", bucket)
+	}
+	old, err := BucketName(target)
+	if err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(target)
+	u.Host = bucket + strings.TrimPrefix(u.Host, old)
+	return u.String(), nil
+}
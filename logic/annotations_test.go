@@ -0,0 +1,95 @@
+package logic
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"dump-handler/pkg/compress"
+	"dump-handler/thirdparty/storage"
+)
+
+func TestParseOverrides(t *testing.T) {
+	o, errs := ParseOverrides(map[string]string{
+		"dump-handler.io/bucket":    "pay-dumps",
+		"dump-handler.io/retention": "30d",
+		"dump-handler.io/notify":    "pay-ding, pay-am",
+		"dump-handler.io/compress":  "zstd",
+		"dump-handler.io/disable":   "false",
+		"dump-handler.io/typo":      "x",
+		"other.io/bucket":           "ignored",
+	})
+	if o.Bucket != "pay-dumps" || o.Retention != 30*24*time.Hour || len(o.Notify) != 2 || o.Notify[1] != "pay-am" ||
+		o.Compress != compress.Zstd || o.Disable || len(errs) != 1 {
+		t.Fatalf("got %+v %v", o, errs)
+	}
+
+	o, errs = ParseOverrides(map[string]string{
+		"dump-handler.io/notify":    "none",
+		"dump-handler.io/compress":  "lz4",
+		"dump-handler.io/retention": "-1h",
+		"dump-handler.io/disable":   "yes",
+	})
+	if o.Notify == nil || len(o.Notify) != 0 || o.Compress != "" || o.Retention != 0 || len(errs) != 3 {
+		t.Fatalf("got %+v %v", o, errs)
+	}
+}
+
+func TestWithBucket(t *testing.T) {
+	cases := []struct{ target, bucket, want string }{
+		{"cos://dumps-1250000000.cos.ap-beijing.myqcloud.com", "pay-1250000000", "cos://pay-1250000000.cos.ap-beijing.myqcloud.com"},
+		{"oss://dumps.oss-cn-beijing.aliyuncs.com", "pay", "oss://pay.oss-cn-beijing.aliyuncs.com"},
+		{"oss://dumps?endpoint=http://127.0.0.1:9000", "pay", "oss://pay?endpoint=http://127.0.0.1:9000"},
+		{"s3://dumps?region=us-east-1", "pay", "s3://pay?region=us-east-1"},
+	}
+	for _, c := range cases {
+		got, err := WithBucket(c.target, c.bucket)
+		if err != nil || got != c.want {
+			t.Fatalf("%s: got %s %v", c.target, got, err)
+		}
+	}
+	if _, err := WithBucket("file:///data/dumps", "pay"); err == nil {
+		t.Fatal("file target has no bucket")
+	}
+	// 不能借注解换scheme、endpoint
+	for _, b := range []string{"file:///data/pay", "s3://pay?endpoint=http://evil", "pay.evil.com", "pay/x", "Pay"} {
+		if _, err := WithBucket("s3://dumps", b); err == nil {
+			t.Fatalf("%s should be rejected", b)
+		}
+	}
+	if _, errs := ParseOverrides(map[string]string{AnnotationBucket: "s3://pay"}); len(errs) != 1 {
+		t.Fatalf("full url in bucket annotation should be rejected, got %v", errs)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := storage.New("file://"+dir, storage.Credential{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	for key, until := range map[string]*time.Time{"jvm/old": &past, "jvm/new": &future, "jvm/keep": nil} {
+		backend.Put(ctx, key, strings.NewReader("dump"), nil)
+		UploadManifest(ctx, backend, DumpManifest{Key: key, RetainUntil: until})
+	}
+
+	if n, err := Prune(ctx, backend, "jvm/", now, true); err != nil || n != 1 {
+		t.Fatalf("dry run: %d %v", n, err)
+	}
+	if n, err := Prune(ctx, backend, "jvm/", now, false); err != nil || n != 1 {
+		t.Fatalf("prune: %d %v", n, err)
+	}
+	objs, _ := backend.List(ctx, "jvm/")
+	if len(objs) != 4 {
+		t.Fatalf("left %v", objs)
+	}
+	for _, o := range objs {
+		if strings.HasPrefix(o.Key, "jvm/old") {
+			t.Fatalf("%s not pruned", o.Key)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package logic
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dump-handler/pkg/envelope"
+	"dump-handler/thirdparty/storage"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// Artifact 与dump一起上传的附属文件，如hs_err_pid*.log、GC日志、stdout
+type Artifact struct {
+	Name      string `json:"name"`                // 文件名
+	Key       string `json:"key"`                 // 对象名
+	Size      int64  `json:"size"`                // 上传的字节数，压缩、加密前
+	Truncated bool   `json:"truncated,omitempty"` // 超过大小上限，只上传了末尾
+	Link      string `json:"link,omitempty"`      // 下载地址，通知时填充
+}
+
+// FindArtifacts 每个glob取最新修改的一个文件，相对路径相对于dump所在目录；
+// 早于since修改的是以前事故留下的文件，忽略
+func FindArtifacts(dump string, globs []string, since time.Time) []string {
+	var paths []string
+	seen := map[string]bool{dump: true}
+	for _, g := range globs {
+		if !filepath.IsAbs(g) {
+			g = filepath.Join(filepath.Dir(dump), g)
+		}
+		matches, err := filepath.Glob(g)
+		if err != nil {
+			logger.Warningf("[artifact][glob:%s][err:%v]", g, err)
+			continue
+		}
+		var newest string
+		var mtime time.Time
+		for _, m := range matches {
+			fi, err := os.Stat(m)
+			if err != nil || !fi.Mode().IsRegular() || seen[m] || fi.ModTime().Before(since) {
+				continue
+			}
+			if newest == "" || fi.ModTime().After(mtime) {
+				newest, mtime = m, fi.ModTime()
+			}
+		}
+		if newest != "" {
+			seen[newest] = true
+			paths = append(paths, newest)
+		}
+	}
+	return paths
+}
+
+// ArtifactKey 附属文件的对象名: <dump对象名去掉压缩、加密后缀>.<文件名>
+func ArtifactKey(dumpKey, name string, opt UploadOptions) string {
+	base := strings.TrimSuffix(dumpKey, envelope.Extension)
+	if opt.Codec != "" {
+		base = strings.TrimSuffix(base, opt.Codec.Extension())
+	}
+	return base + "." + name
+}
+
+// UploadArtifacts 逐个上传附属文件，超过maxSize的只上传末尾maxSize字节，0为不限制；
+// 失败的只记日志，不影响dump
+func UploadArtifacts(ctx context.Context, backend storage.Backend, dumpKey string, paths []string, maxSize int64, opt UploadOptions) []Artifact {
+	var arts []Artifact
+	for _, p := range paths {
+		a, err := uploadArtifact(ctx, backend, dumpKey, p, maxSize, opt)
+		if err != nil {
+			logger.Errorf("[artifact][path:%s][err:%v]", p, err)
+			continue
+		}
+		logger.Infof("[artifact][path:%s][key:%s][size:%d][truncated:%v]", p, a.Key, a.Size, a.Truncated)
+		arts = append(arts, a)
+	}
+	return arts
+}
+
+func uploadArtifact(ctx context.Context, backend storage.Backend, dumpKey, path string, maxSize int64, opt UploadOptions) (Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Artifact{}, err
+	}
+	a := Artifact{Name: filepath.Base(path), Size: fi.Size()}
+	if maxSize > 0 && a.Size > maxSize {
+		if _, err := f.Seek(a.Size-maxSize, io.SeekStart); err != nil {
+			return a, err
+		}
+		a.Size, a.Truncated = maxSize, true
+	}
+	a.Key, err = UploadStream(ctx, backend, ArtifactKey(dumpKey, a.Name, opt), io.LimitReader(f, a.Size), opt)
+	return a, err
+}
+
+// ArtifactNames 告警标签中的附属文件列表
+func ArtifactNames(arts []Artifact) string {
+	names := make([]string, 0, len(arts))
+	for _, a := range arts {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,104 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"dump-handler/pkg/compress"
+	"dump-handler/pkg/envelope"
+	"dump-handler/thirdparty/storage"
+)
+
+func TestFindArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := map[string]time.Duration{
+		"oom":                 0,
+		"hs_err_pid1.log":     -2 * time.Minute,
+		"hs_err_pid7.log":     -time.Minute,
+		"gc.log":              -3 * time.Hour, // 以前的事故
+		"stdout.log":          0,
+		"logs/gc.log.0":       -time.Minute,
+		"logs/gc.log.current": 0,
+	}
+	for name, age := range files {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		ioutil.WriteFile(p, []byte(name), 0644)
+		os.Chtimes(p, now.Add(age), now.Add(age))
+	}
+	dump := filepath.Join(dir, "oom")
+	got := FindArtifacts(dump, []string{"hs_err_pid*.log", "gc*.log*", "logs/gc.log*", "*", "[", dir + "/stdout*.log"}, now.Add(-time.Hour))
+	want := []string{
+		filepath.Join(dir, "hs_err_pid7.log"),
+		filepath.Join(dir, "logs/gc.log.current"),
+		filepath.Join(dir, "stdout.log"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestUploadArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := storage.New("file://"+filepath.Join(dir, "bucket"), storage.Credential{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsErr := filepath.Join(dir, "hs_err_pid1.log")
+	stdout := filepath.Join(dir, "stdout.log")
+	ioutil.WriteFile(hsErr, []byte("# SIGSEGV"), 0644)
+	ioutil.WriteFile(stdout, []byte(strings.Repeat("x", 100)+"last line\n"), 0644)
+	kw, _ := envelope.NewLocalKey(bytes.Repeat([]byte{3}, 32))
+	opt := UploadOptions{Codec: compress.Gzip, Encryption: kw}
+
+	ctx := context.Background()
+	arts := UploadArtifacts(ctx, backend, "ka/env/jvm/pod-1.gz.enc", []string{hsErr, filepath.Join(dir, "missing"), stdout}, 10, opt)
+	if len(arts) != 2 {
+		t.Fatalf("got %+v", arts)
+	}
+	if arts[0].Key != "ka/env/jvm/pod-1.hs_err_pid1.log.gz.enc" || arts[0].Truncated {
+		t.Fatalf("got %+v", arts[0])
+	}
+	if arts[1].Key != "ka/env/jvm/pod-1.stdout.log.gz.enc" || !arts[1].Truncated || arts[1].Size != 10 {
+		t.Fatalf("got %+v", arts[1])
+	}
+	r, err := OpenDump(ctx, backend, arts[1].Key, kw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, _ := ioutil.ReadAll(r); string(got) != "last line\n" {
+		t.Fatalf("tail %q", got)
+	}
+	if ArtifactNames(arts) != "hs_err_pid1.log,stdout.log" {
+		t.Fatalf("names %q", ArtifactNames(arts))
+	}
+}
+
+func TestPruneArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := storage.New("file://"+dir, storage.Credential{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	backend.Put(ctx, "jvm/old", strings.NewReader("dump"), nil)
+	backend.Put(ctx, "jvm/old.hs_err_pid1.log", strings.NewReader("crash"), nil)
+	UploadManifest(ctx, backend, DumpManifest{Key: "jvm/old", RetainUntil: &past, Artifacts: []Artifact{{Name: "hs_err_pid1.log", Key: "jvm/old.hs_err_pid1.log"}}})
+	if n, err := Prune(ctx, backend, "jvm/", now, false); err != nil || n != 1 {
+		t.Fatalf("prune: %d %v", n, err)
+	}
+	if objs, _ := backend.List(ctx, "jvm/"); len(objs) != 0 {
+		t.Fatalf("left %v", objs)
+	}
+}
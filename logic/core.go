@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	"dump-handler/thirdparty/prom"
+)
+
+const BIZ_CORE_DUMP = "biz_core_dump"
+
+// DefaultCoreKeyTemplate core dump的对象名模板
+const DefaultCoreKeyTemplate = "{{.Ka}}/{{.Env}}/core/{{.Pod}}-{{.Exe}}-{{.Time}}"
+
+// ParseKeyTemplate 解析对象名模板并用空数据试渲染一次
+func ParseKeyTemplate(text string) (*template.Template, error) {
+	t, err := template.New("key").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := renderKey(t, RouteInfo{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RenderKey 用模板渲染对象名
+func RenderKey(t *template.Template, info RouteInfo) (string, error) {
+	r := Route{Name: "core", key: t}
+	return r.Key(info)
+}
+
+// 常见的产生core dump的信号，其他的显示为SIG<编号>
+var signalNames = map[int]string{
+	3:  "SIGQUIT",
+	4:  "SIGILL",
+	5:  "SIGTRAP",
+	6:  "SIGABRT",
+	7:  "SIGBUS",
+	8:  "SIGFPE",
+	11: "SIGSEGV",
+	24: "SIGXCPU",
+	25: "SIGXFSZ",
+	31: "SIGSYS",
+}
+
+// SignalName 11 -> SIGSEGV
+func SignalName(sig int) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("SIG%d", sig)
+}
+
+// NewCoreAlarm core dump上传成功的告警，比biz_oom_dump多signal、exe标签
+func NewCoreAlarm(cosUrl, fileName, ka, env, signal, exe string) prom.MetricPoint {
+	tags := newOOMDumpTags(cosUrl, fileName, ka, env)
+	tags["signal"] = signal
+	tags["exe"] = exe
+	return *prom.NewMetricPoint(BIZ_CORE_DUMP, tags, time.Now().Unix(), float64(1))
+}
+
+// NewCoreFailedAlarm core dump上传失败的告警。core从管道流式读取，失败后无法重放，
+// 用status=upload_failed区分，reason为失败原因，过长时截断
+func NewCoreFailedAlarm(cosUrl, fileName, ka, env, signal, exe, reason string) prom.MetricPoint {
+	point := NewCoreAlarm(cosUrl, fileName, ka, env, signal, exe)
+	if len(reason) > 200 {
+		reason = reason[:200] + "..."
+	}
+	point.TagsMap["status"] = "upload_failed"
+	point.TagsMap["reason"] = reason
+	return point
+}
@@ -0,0 +1,72 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dump-handler/pkg/podname"
+)
+
+func TestCoreDump(t *testing.T) {
+	if SignalName(11) != "SIGSEGV" || SignalName(64) != "SIG64" {
+		t.Fatal("SignalName")
+	}
+	kt, err := ParseKeyTemplate(DefaultCoreKeyTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := NewRouteInfo(podname.Parser{}.Parse("pay-ledger-0"), "ka", "prod", time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	info.Exe = "ledgerd"
+	if key, err := RenderKey(kt, info); err != nil || key != "ka/prod/core/pay-ledger-0-ledgerd-20210601120000" {
+		t.Fatalf("key: %s %v", key, err)
+	}
+
+	alarm := NewCoreAlarm("https://bucket", "k", "ka", "prod", "SIGSEGV", "ledgerd")
+	if alarm.Metric != BIZ_CORE_DUMP || alarm.TagsMap["signal"] != "SIGSEGV" || alarm.TagsMap["exe"] != "ledgerd" {
+		t.Fatalf("alarm: %+v", alarm)
+	}
+
+	failed := NewCoreFailedAlarm("https://bucket", "k", "ka", "prod", "SIGSEGV", "ledgerd", strings.Repeat("x", 300))
+	if failed.Metric != BIZ_CORE_DUMP || failed.TagsMap["status"] != "upload_failed" || len(failed.TagsMap["reason"]) != 203 {
+		t.Fatalf("failed alarm: %+v", failed)
+	}
+
+	e := OOMDumpEvent{Pod: "pay-ledger-0", Ka: "ka", Env: "prod", Exe: "ledgerd", Signal: "SIGSEGV", Size: 1 << 20}
+	title, body, err := renderMessage(nil, "dingtalk", e)
+	if err != nil || title != "[ka/prod] pay-ledger-0 ledgerd SIGSEGV" || !strings.HasPrefix(body, "### ledgerd SIGSEGV core dump: pay-ledger-0") {
+		t.Fatalf("message: %q %q %v", title, body, err)
+	}
+	a, err := AlertmanagerNotifier{}.NewAlert(e)
+	if err != nil || a.Labels["alertname"] != CoreAlertName || a.Labels["signal"] != "SIGSEGV" ||
+		a.Annotations["summary"] != "pay-ledger-0 ledgerd crashed with SIGSEGV, core dump uploaded (1.0MiB)" {
+		t.Fatalf("alert: %+v %v", a, err)
+	}
+}
+
+func TestThreadDump(t *testing.T) {
+	kt, err := ParseKeyTemplate(DefaultThreadKeyTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := NewRouteInfo(podname.Parser{}.Parse("pay-ledger-0"), "ka", "prod", time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	if key, err := RenderKey(kt, info); err != nil || key != "ka/prod/threads/pay-ledger-0-20210601120000" {
+		t.Fatalf("key: %s %v", key, err)
+	}
+
+	alarm := NewThreadDumpAlarm("https://bucket", "k", "ka", "prod", 3)
+	if alarm.Metric != BIZ_THREAD_DUMP || alarm.TagsMap["samples"] != "3" {
+		t.Fatalf("alarm: %+v", alarm)
+	}
+
+	e := OOMDumpEvent{Pod: "pay-ledger-0", Ka: "ka", Env: "prod", Samples: 3, Size: 1 << 20}
+	title, body, err := renderMessage(nil, "dingtalk", e)
+	if err != nil || title != "[ka/prod] pay-ledger-0 thread dump" || !strings.HasPrefix(body, "### JVM thread dump x3: pay-ledger-0") {
+		t.Fatalf("message: %q %q %v", title, body, err)
+	}
+	a, err := AlertmanagerNotifier{}.NewAlert(e)
+	if err != nil || a.Labels["alertname"] != ThreadDumpAlertName || a.Labels["severity"] != "warning" ||
+		a.Annotations["summary"] != "pay-ledger-0 3 thread dump samples uploaded (1.0MiB)" {
+		t.Fatalf("alert: %+v %v", a, err)
+	}
+}
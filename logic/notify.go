@@ -0,0 +1,247 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dump-handler/pkg/dumpfile"
+	"dump-handler/pkg/podname"
+	"dump-handler/thirdparty/dingtalk"
+	"dump-handler/thirdparty/feishu"
+	"dump-handler/thirdparty/slack"
+	"dump-handler/thirdparty/storage"
+	"dump-handler/thirdparty/webhook"
+	"dump-handler/thirdparty/wecom"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// OOMDumpEvent dump上传成功后发给各通知渠道的内容，也是消息模板的数据
+type OOMDumpEvent struct {
+	Pod       string `json:"pod"`
+	Workload  string `json:"workload"` // 去掉hash、序号后的工作负载名
+	Kind      string `json:"kind"`     // 工作负载类型
+	App       string `json:"app"`
+	Team      string `json:"team"` // 项目组
+	Ka        string `json:"ka"`
+	Env       string `json:"env"`
+	Hostname  string `json:"hostname"`          // 执行上传的主机
+	Key       string `json:"key"`               // 对象名
+	Size      int64  `json:"size"`              // dump文件大小，压缩、加密前
+	ObjectURL string `json:"object_url"`        // 对象地址，私有桶需要凭证才能访问
+	Link      string `json:"link"`              // 下载地址，后端支持时为预签名地址
+	Summary   string `json:"summary"`           // hprof文件头和校验结果的摘要，不是hprof时为空
+	Exe       string `json:"exe,omitempty"`     // core dump的可执行文件名，OOM时为空
+	Signal    string `json:"signal,omitempty"`  // core dump的信号，如SIGSEGV
+	Samples   int    `json:"samples,omitempty"` // 线程dump的抓取次数，其他dump为0
+
+	Artifacts []Artifact `json:"artifacts,omitempty"` // 一起上传的hs_err、GC日志等附属文件
+
+	// 开启pod信息查询时填充
+	Namespace string            `json:"namespace,omitempty"`
+	Node      string            `json:"node,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"` // Alertmanager告警的附加标签
+	Meta      *PodMeta          `json:"meta,omitempty"`
+}
+
+// HprofSummary hprof文件头和完整性校验结果的摘要，h为nil时为空
+func HprofSummary(h *dumpfile.HprofHeader, validated bool) string {
+	if h == nil {
+		return ""
+	}
+	s := fmt.Sprintf("%s，id %d字节，JVM写入时间 %s", h.Version, h.IDSize, h.Time.Format("2006-01-02 15:04:05 MST"))
+	if validated {
+		s += "，记录完整"
+	}
+	return s
+}
+
+// WithPodMeta 附加pod信息，labelKeys为要带到告警标签中的pod标签
+func (e OOMDumpEvent) WithPodMeta(m *PodMeta, labelKeys []string) OOMDumpEvent {
+	if m == nil {
+		return e
+	}
+	e.Meta = m
+	e.Namespace, e.Node = m.Namespace, m.Node
+	e.Labels = m.AlertLabels(labelKeys)
+	return e
+}
+
+// WithArtifacts 附加附属文件及其下载地址
+func (e OOMDumpEvent) WithArtifacts(ctx context.Context, backend storage.Backend, arts []Artifact, linkExpire time.Duration) OOMDumpEvent {
+	e.Artifacts = make([]Artifact, len(arts))
+	for i, a := range arts {
+		_, a.Link = presign(ctx, backend, a.Key, linkExpire)
+		e.Artifacts[i] = a
+	}
+	return e
+}
+
+// presign 对象地址和下载地址，下载地址优先使用预签名地址，失败时退回对象地址
+func presign(ctx context.Context, backend storage.Backend, key string, linkExpire time.Duration) (string, string) {
+	objectURL := strings.TrimSuffix(backend.URL(), "/") + "/" + key
+	link, err := backend.Presign(ctx, key, linkExpire)
+	if err != nil {
+		logger.Warningf("[presign_error][key:%s][err:%v]", key, err)
+		link = objectURL
+	}
+	return objectURL, link
+}
+
+// NewOOMDumpEvent 下载地址优先使用预签名地址，有效期linkExpire，失败时退回对象地址
+func NewOOMDumpEvent(ctx context.Context, backend storage.Backend, key string, size int64, pod podname.Info, ka, env string, linkExpire time.Duration) OOMDumpEvent {
+	objectURL, link := presign(ctx, backend, key, linkExpire)
+	hostname, _ := os.Hostname()
+	return OOMDumpEvent{
+		Pod:       pod.Pod,
+		Workload:  pod.Workload,
+		Kind:      string(pod.Kind),
+		App:       pod.App,
+		Team:      pod.Team,
+		Ka:        ka,
+		Env:       env,
+		Hostname:  hostname,
+		Key:       key,
+		Size:      size,
+		ObjectURL: objectURL,
+		Link:      link,
+	}
+}
+
+// renderMessage 渲染渠道的标题和正文
+func renderMessage(ts *Templates, channel string, e OOMDumpEvent) (string, string, error) {
+	title, err := ts.Render(channel, "title", e)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := ts.Render(channel, "body", e)
+	if err != nil {
+		return "", "", err
+	}
+	return title, body, nil
+}
+
+// Notifier 一个通知渠道
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, e OOMDumpEvent) error
+}
+
+// 以下各渠道的Templates为nil时使用内置模板
+
+type DingTalkNotifier struct {
+	Robot     *dingtalk.Robot
+	Templates *Templates
+}
+
+func (n DingTalkNotifier) Name() string { return "dingtalk" }
+
+func (n DingTalkNotifier) Notify(ctx context.Context, e OOMDumpEvent) error {
+	title, body, err := renderMessage(n.Templates, n.Name(), e)
+	if err != nil {
+		return err
+	}
+	return n.Robot.SendMarkdown(ctx, title, body)
+}
+
+type WeComNotifier struct {
+	Robot     *wecom.Robot
+	Templates *Templates
+}
+
+func (n WeComNotifier) Name() string { return "wecom" }
+
+func (n WeComNotifier) Notify(ctx context.Context, e OOMDumpEvent) error {
+	body, err := n.Templates.Render(n.Name(), "body", e)
+	if err != nil {
+		return err
+	}
+	return n.Robot.SendMarkdown(ctx, body)
+}
+
+type FeishuNotifier struct {
+	Robot     *feishu.Robot
+	Templates *Templates
+}
+
+func (n FeishuNotifier) Name() string { return "feishu" }
+
+func (n FeishuNotifier) Notify(ctx context.Context, e OOMDumpEvent) error {
+	title, body, err := renderMessage(n.Templates, n.Name(), e)
+	if err != nil {
+		return err
+	}
+	return n.Robot.SendMarkdown(ctx, title, body)
+}
+
+type SlackNotifier struct {
+	Webhook   *slack.Webhook
+	Templates *Templates
+}
+
+func (n SlackNotifier) Name() string { return "slack" }
+
+func (n SlackNotifier) Notify(ctx context.Context, e OOMDumpEvent) error {
+	body, err := n.Templates.Render(n.Name(), "body", e)
+	if err != nil {
+		return err
+	}
+	return n.Webhook.Send(ctx, body)
+}
+
+// WebhookNotifier 把OOMDumpEvent原样以JSON发送
+type WebhookNotifier struct {
+	Webhook *webhook.Webhook
+}
+
+func (n WebhookNotifier) Name() string { return "webhook" }
+
+func (n WebhookNotifier) Notify(ctx context.Context, e OOMDumpEvent) error {
+	return n.Webhook.Post(ctx, e)
+}
+
+// NotifyResult 单个渠道的发送结果
+type NotifyResult struct {
+	Name string
+	Err  error
+}
+
+// NotifyAll 并发发送到所有渠道，每个渠道单独超时、单独recover，某个渠道失败或卡住不影响其他渠道
+func NotifyAll(ctx context.Context, notifiers []Notifier, e OOMDumpEvent, timeout time.Duration) []NotifyResult {
+	results := make([]NotifyResult, len(notifiers))
+	var wg sync.WaitGroup
+	for i, n := range notifiers {
+		wg.Add(1)
+		go func(i int, n Notifier) {
+			defer wg.Done()
+			results[i] = NotifyResult{Name: n.Name(), Err: notifyOne(ctx, n, e, timeout)}
+		}(i, n)
+	}
+	wg.Wait()
+	for _, r := range results {
+		if r.Err != nil {
+			logger.Errorf("[notify_failed][channel:%s][pod:%s][err:%v]", r.Name, e.Pod, r.Err)
+		} else {
+			logger.Infof("[notify_done][channel:%s][pod:%s][key:%s]", r.Name, e.Pod, e.Key)
+		}
+	}
+	return results
+}
+
+func notifyOne(ctx context.Context, n Notifier, e OOMDumpEvent, timeout time.Duration) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return n.Notify(ctx, e)
+}
@@ -0,0 +1,129 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dump-handler/pkg/dumpfile"
+	"dump-handler/thirdparty/feishu"
+	"dump-handler/thirdparty/slack"
+	"dump-handler/thirdparty/webhook"
+	"dump-handler/thirdparty/wecom"
+)
+
+type panicNotifier struct{}
+
+func (panicNotifier) Name() string { return "panic" }
+func (panicNotifier) Notify(context.Context, OOMDumpEvent) error {
+	panic("boom")
+}
+
+type hangNotifier struct{}
+
+func (hangNotifier) Name() string { return "hang" }
+func (hangNotifier) Notify(ctx context.Context, _ OOMDumpEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type failNotifier struct{}
+
+func (failNotifier) Name() string { return "fail" }
+func (failNotifier) Notify(context.Context, OOMDumpEvent) error {
+	return errors.New("broken")
+}
+
+func TestNotifyAll(t *testing.T) {
+	var mu sync.Mutex
+	bodies := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = string(data)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/wecom":
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		case "/feishu":
+			var msg map[string]interface{}
+			json.Unmarshal(data, &msg)
+			ts, _ := msg["timestamp"].(string)
+			if sign, _ := msg["sign"].(string); ts == "" || sign == "" {
+				w.Write([]byte(`{"code":19021,"msg":"sign match fail"}`))
+				return
+			}
+			w.Write([]byte(`{"code":0,"msg":"success"}`))
+		case "/slack":
+			w.Write([]byte("ok"))
+		case "/webhook":
+			if r.Header.Get("Authorization") != "Bearer t" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ev := OOMDumpEvent{Pod: "ops-demo-7d9f", Ka: "ka", Env: "prod", Key: "ka/prod/jvm/ops-demo-7d9f-1", Link: "https://bucket/ka/prod/jvm/ops-demo-7d9f-1?sig=x"}
+	ns := []Notifier{
+		WeComNotifier{Robot: wecom.NewRobot(srv.URL + "/wecom")},
+		FeishuNotifier{Robot: feishu.NewRobot(srv.URL+"/feishu", "s")},
+		panicNotifier{},
+		SlackNotifier{Webhook: slack.NewWebhook(srv.URL + "/slack")},
+		hangNotifier{},
+		failNotifier{},
+		WebhookNotifier{Webhook: webhook.New(srv.URL+"/webhook", map[string]string{"Authorization": "Bearer t"})},
+	}
+	start := time.Now()
+	res := NotifyAll(context.Background(), ns, ev, 200*time.Millisecond)
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("hanging channel blocked NotifyAll")
+	}
+	want := map[string]bool{"wecom": true, "feishu": true, "panic": false, "slack": true, "hang": false, "fail": false, "webhook": true}
+	for _, r := range res {
+		if (r.Err == nil) != want[r.Name] {
+			t.Fatalf("%s: unexpected result %v", r.Name, r.Err)
+		}
+	}
+	if !strings.Contains(bodies["/wecom"], "ops-demo-7d9f") || !strings.Contains(bodies["/slack"], `|download dump\u003e`) {
+		t.Fatalf("unexpected bodies: %v", bodies)
+	}
+	var got OOMDumpEvent
+	if json.Unmarshal([]byte(bodies["/webhook"]), &got); !reflect.DeepEqual(got, ev) {
+		t.Fatalf("webhook payload mismatch: %+v", got)
+	}
+}
+
+func TestAlertmanagerNotifier(t *testing.T) {
+	n := AlertmanagerNotifier{EndsAfter: time.Hour}
+	a, err := n.NewAlert(OOMDumpEvent{Pod: "ops-demo-7d9f8c-xk2z", Team: "ops", App: "demo", Ka: "ka", Env: "prod", Key: "k", Link: "l", Size: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Labels["team"] != "ops" || a.Labels["app"] != "demo" || a.Labels["alertname"] != AlertName ||
+		a.Annotations["dump_link"] != "l" || a.Annotations["dump_size"] != "1024" ||
+		a.Annotations["summary"] != "ops-demo-7d9f8c-xk2z OOM, heap dump uploaded (1.0KiB)" {
+		t.Fatalf("unexpected alert: %+v", a)
+	}
+	if d := a.EndsAt.Sub(a.StartsAt); d != time.Hour {
+		t.Fatalf("endsAt should be startsAt+1h, got %v", d)
+	}
+}
+
+func TestHprofSummary(t *testing.T) {
+	h := &dumpfile.HprofHeader{Version: "JAVA PROFILE 1.0.2", IDSize: 8, Time: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)}
+	if s := HprofSummary(h, true); s != "JAVA PROFILE 1.0.2，id 8字节，JVM写入时间 2021-06-01 12:00:00 UTC，记录完整" {
+		t.Fatalf("summary: %q", s)
+	}
+	if HprofSummary(nil, true) != "" {
+		t.Fatal("non hprof dump should have no summary")
+	}
+}
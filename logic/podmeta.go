@@ -0,0 +1,155 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"dump-handler/pkg/podname"
+	"dump-handler/thirdparty/k8s"
+	"dump-handler/thirdparty/storage"
+)
+
+// ManifestSuffix dump旁边的pod信息清单，对象名为dump对象名加该后缀
+const ManifestSuffix = ".meta.json"
+
+// PodMeta 从API server或downward API读到的pod信息
+type PodMeta struct {
+	Source       string            `json:"source"` // api、downward
+	Namespace    string            `json:"namespace"`
+	Name         string            `json:"name"`
+	UID          string            `json:"uid,omitempty"`
+	Node         string            `json:"node,omitempty"`
+	HostIP       string            `json:"host_ip,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	OwnerKind    string            `json:"owner_kind,omitempty"` // 控制器类型的ownerReference
+	OwnerName    string            `json:"owner_name,omitempty"`
+	Container    string            `json:"container,omitempty"`
+	Image        string            `json:"image,omitempty"`
+	Limits       map[string]string `json:"limits,omitempty"`
+	Requests     map[string]string `json:"requests,omitempty"`
+	RestartCount int               `json:"restart_count"`
+}
+
+// NewPodMeta container为JVM所在的容器名，为空时取第一个容器
+func NewPodMeta(pod *k8s.Pod, container, source string) *PodMeta {
+	m := &PodMeta{
+		Source:      source,
+		Namespace:   pod.Metadata.Namespace,
+		Name:        pod.Metadata.Name,
+		UID:         pod.Metadata.UID,
+		Node:        pod.Spec.NodeName,
+		HostIP:      pod.Status.HostIP,
+		Labels:      pod.Metadata.Labels,
+		Annotations: pod.Metadata.Annotations,
+	}
+	if o := pod.Controller(); o != nil {
+		m.OwnerKind, m.OwnerName = o.Kind, o.Name
+	}
+	for i, c := range pod.Spec.Containers {
+		if c.Name == container || (container == "" && i == 0) {
+			m.Container, m.Image = c.Name, c.Image
+			m.Limits, m.Requests = c.Resources.Limits, c.Resources.Requests
+			break
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == m.Container {
+			m.RestartCount = cs.RestartCount
+		}
+	}
+	return m
+}
+
+var cronJobName = regexp.MustCompile(`^(.+)-[0-9]{8,}$`)
+
+// Workload 按ownerReferences推断顶层工作负载，ReplicaSet归到Deployment，
+// CronJob创建的Job归到CronJob，没有控制器时返回空
+func (m *PodMeta) Workload() (string, podname.Kind) {
+	switch m.OwnerKind {
+	case "":
+		return "", ""
+	case "ReplicaSet":
+		if i := strings.LastIndex(m.OwnerName, "-"); i > 0 {
+			return m.OwnerName[:i], podname.Deployment
+		}
+	case "Job":
+		if sub := cronJobName.FindStringSubmatch(m.OwnerName); sub != nil {
+			return sub[1], podname.CronJob
+		}
+	}
+	return m.OwnerName, podname.Kind(m.OwnerKind)
+}
+
+// ObjectMetadata 写入dump对象的自定义元数据，只放体积小的字段，完整信息见清单
+func (m *PodMeta) ObjectMetadata() map[string]string {
+	md := map[string]string{
+		"k8s-namespace":     m.Namespace,
+		"k8s-node":          m.Node,
+		"k8s-container":     m.Container,
+		"k8s-image":         m.Image,
+		"k8s-restart-count": fmt.Sprintf("%d", m.RestartCount),
+	}
+	if m.OwnerKind != "" {
+		md["k8s-owner"] = m.OwnerKind + "/" + m.OwnerName
+	}
+	if v := m.Limits["memory"]; v != "" {
+		md["k8s-memory-limit"] = v
+	}
+	for k, v := range md {
+		if v == "" {
+			delete(md, k)
+		}
+	}
+	return md
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// AlertLabels Alertmanager告警的附加标签：namespace、node，以及labelKeys中列出的pod标签，
+// 与kube-state-metrics一样命名为label_<标签名>
+func (m *PodMeta) AlertLabels(labelKeys []string) map[string]string {
+	ls := map[string]string{}
+	if m.Namespace != "" {
+		ls["namespace"] = m.Namespace
+	}
+	if m.Node != "" {
+		ls["node"] = m.Node
+	}
+	for _, k := range labelKeys {
+		if v, ok := m.Labels[k]; ok {
+			ls["label_"+invalidLabelChars.ReplaceAllString(k, "_")] = v
+		}
+	}
+	return ls
+}
+
+// DumpManifest 与dump一起上传的JSON清单
+type DumpManifest struct {
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	Uploaded time.Time `json:"uploaded"`
+	Ka       string    `json:"ka"`
+	Env      string    `json:"env"`
+	Pod      *PodMeta  `json:"pod"`
+
+	RetainUntil *time.Time `json:"retain_until,omitempty"` // 注解或-retention指定的过期时间
+	Artifacts   []Artifact `json:"artifacts,omitempty"`    // 附属文件，prune时一起删除
+}
+
+// UploadManifest 上传到 <dump对象名>.meta.json
+func UploadManifest(ctx context.Context, backend storage.Backend, m DumpManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, m.Key+ManifestSuffix, bytes.NewReader(data), &storage.PutOptions{
+		ContentType: "application/json",
+		Size:        int64(len(data)),
+	})
+}
@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"dump-handler/pkg/podname"
+	"dump-handler/thirdparty/k8s"
+	"dump-handler/thirdparty/storage"
+)
+
+// 模拟API server，只返回一个pod
+func fakeAPIServer(t *testing.T) *httptest.Server {
+	pod := `{
+	  "metadata": {
+	    "name": "ops-demo-0", "namespace": "ops",
+	    "labels": {"app.kubernetes.io/name": "demo", "tier": "backend"},
+	    "ownerReferences": [{"kind": "ReplicaSet", "name": "ops-demo-canary-6b9f7c5d4", "controller": true}]
+	  },
+	  "spec": {"nodeName": "node-1", "containers": [
+	    {"name": "istio-proxy", "image": "istio/proxyv2"},
+	    {"name": "app", "image": "demo:1.0", "resources": {"limits": {"memory": "2Gi"}}}
+	  ]},
+	  "status": {"containerStatuses": [{"name": "istio-proxy", "restartCount": 0}, {"name": "app", "restartCount": 3}]}
+	}`
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/ops/pods/ops-demo-0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(pod))
+	}))
+}
+
+func TestPodMeta(t *testing.T) {
+	srv := fakeAPIServer(t)
+	defer srv.Close()
+	pod, err := k8s.NewClient(srv.URL, "", srv.Client()).GetPod(context.Background(), "ops", "ops-demo-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewPodMeta(pod, "app", "api")
+	if m.Image != "demo:1.0" || m.RestartCount != 3 || m.Limits["memory"] != "2Gi" {
+		t.Fatalf("got %+v", m)
+	}
+
+	// pod名看起来像StatefulSet，以ownerReferences为准
+	workload, kind := m.Workload()
+	p := podname.Parser{}
+	info := p.WithWorkload(p.Parse("ops-demo-0"), workload, kind)
+	if info.Workload != "ops-demo-canary" || info.Kind != podname.Deployment || info.App != "demo-canary" {
+		t.Fatalf("workload: %+v", info)
+	}
+
+	md := m.ObjectMetadata()
+	if md["k8s-owner"] != "ReplicaSet/ops-demo-canary-6b9f7c5d4" || md["k8s-memory-limit"] != "2Gi" || md["k8s-restart-count"] != "3" {
+		t.Fatalf("metadata: %v", md)
+	}
+
+	e := OOMDumpEvent{Pod: "ops-demo-0", Team: "pay", Key: "k"}.WithPodMeta(m, []string{"app.kubernetes.io/name", "missing"})
+	e.Labels["team"] = "override"
+	a, err := AlertmanagerNotifier{}.NewAlert(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Labels["namespace"] != "ops" || a.Labels["node"] != "node-1" || a.Labels["label_app_kubernetes_io_name"] != "demo" ||
+		a.Labels["team"] != "pay" || len(a.Labels) != 12 {
+		t.Fatalf("labels: %v", a.Labels)
+	}
+
+	dir := t.TempDir()
+	backend, err := storage.New("file://"+dir, storage.Credential{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UploadManifest(context.Background(), backend, DumpManifest{Key: "ka/env/jvm/ops-demo-0", Size: 10, Pod: m}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "ka/env/jvm/ops-demo-0"+ManifestSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got DumpManifest
+	if err := json.Unmarshal(data, &got); err != nil || got.Pod.Node != "node-1" {
+		t.Fatalf("manifest: %s %v", data, err)
+	}
+}
@@ -0,0 +1,84 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"dump-handler/thirdparty/storage"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// readManifest 读取dump的清单
+func readManifest(ctx context.Context, backend storage.Backend, key string) (*DumpManifest, error) {
+	r, err := backend.Get(ctx, key+ManifestSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var m DumpManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// retainUntil 对象的过期时间，先看对象元数据，不支持元数据的后端(file://)再看清单
+func retainUntil(ctx context.Context, backend storage.Backend, key string) (time.Time, bool) {
+	if info, err := backend.Stat(ctx, key); err == nil {
+		if v := info.Metadata[RetainUntilMeta]; v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			return t, err == nil
+		}
+	}
+	m, err := readManifest(ctx, backend, key)
+	if err != nil || m.RetainUntil == nil {
+		return time.Time{}, false
+	}
+	return *m.RetainUntil, true
+}
+
+// Prune 删除prefix下已过保留期的dump及其清单，没有设置保留期的对象不动，返回删除的dump数
+func Prune(ctx context.Context, backend storage.Backend, prefix string, now time.Time, dryRun bool) (int, error) {
+	objs, err := backend.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, o := range objs {
+		if strings.HasSuffix(o.Key, ManifestSuffix) {
+			continue
+		}
+		until, ok := retainUntil(ctx, backend, o.Key)
+		if !ok || now.Before(until) {
+			continue
+		}
+		logger.Infof("[prune][key:%s][retain_until:%s][dry_run:%v]", o.Key, until.Format(time.RFC3339), dryRun)
+		n++
+		if dryRun {
+			continue
+		}
+		// 清单中的附属文件一起删除，支持元数据的后端上它们也会按自己的元数据删除
+		if m, err := readManifest(ctx, backend, o.Key); err == nil {
+			for _, a := range m.Artifacts {
+				if err := backend.Delete(ctx, a.Key); err != nil {
+					return n, err
+				}
+			}
+		}
+		if err := backend.Delete(ctx, o.Key); err != nil {
+			return n, err
+		}
+		if err := backend.Delete(ctx, o.Key+ManifestSuffix); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,267 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"dump-handler/pkg/podname"
+
+	"dump-handler/thirdparty/alertmanager"
+	"dump-handler/thirdparty/dingtalk"
+	"dump-handler/thirdparty/feishu"
+	"dump-handler/thirdparty/slack"
+	"dump-handler/thirdparty/webhook"
+	"dump-handler/thirdparty/wecom"
+)
+
+// DefaultKeyTemplate 对象名模板，与原来的"ka/env/jvm/podid-时间"一致
+const DefaultKeyTemplate = "{{.Ka}}/{{.Env}}/jvm/{{.Pod}}-{{.Time}}"
+
+var defaultKeyTmpl = template.Must(template.New("key").Parse(DefaultKeyTemplate))
+
+// RouteInfo 路由匹配和对象名模板的数据
+type RouteInfo struct {
+	Pod      string
+	Workload string // 去掉hash、序号后的工作负载名
+	Kind     string // Deployment、StatefulSet、Job、CronJob、Pod
+	Ordinal  int    // StatefulSet的序号，其他为-1
+	Team     string
+	App      string
+	Ka       string
+	Env      string
+	Time     string // 上传时间，20060102150405
+	Exe      string // core dump的可执行文件名，OOM时为空
+}
+
+// NewRouteInfo pod为podname.Parser的解析结果
+func NewRouteInfo(pod podname.Info, ka, env string, now time.Time) RouteInfo {
+	return RouteInfo{
+		Pod:      pod.Pod,
+		Workload: pod.Workload,
+		Kind:     string(pod.Kind),
+		Ordinal:  pod.Ordinal,
+		Team:     pod.Team,
+		App:      pod.App,
+		Ka:       ka,
+		Env:      env,
+		Time:     now.Format("20060102150405"),
+	}
+}
+
+// Route 一条路由规则，匹配条件为空表示不限制，目标为空时使用默认路由的
+type Route struct {
+	Name string `json:"name"`
+	// 匹配条件
+	Team string `json:"team"` // 项目组，逗号分隔多个
+	App  string `json:"app"`  // app名的正则，整体匹配
+	Env  string `json:"env"`  // 逗号分隔多个
+	Ka   string `json:"ka"`   // 逗号分隔多个
+	Kind string `json:"kind"` // 工作负载类型，逗号分隔多个
+	// 目标
+	Target      string   `json:"target"`       // 存储地址
+	KeyTemplate string   `json:"key_template"` // 对象名模板，数据见RouteInfo
+	Notifiers   []string `json:"notifiers"`    // channels中的通知渠道名
+
+	app *regexp.Regexp
+	key *template.Template
+}
+
+func matchList(list, v string) bool {
+	if list == "" {
+		return true
+	}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Route) compile() error {
+	if r.App != "" {
+		re, err := regexp.Compile("^(?:" + r.App + ")$")
+		if err != nil {
+			return fmt.Errorf("app: %v", err)
+		}
+		r.app = re
+	}
+	if r.KeyTemplate != "" {
+		t, err := template.New("key").Parse(r.KeyTemplate)
+		if err != nil {
+			return fmt.Errorf("key_template: %v", err)
+		}
+		if _, err := renderKey(t, RouteInfo{}); err != nil {
+			return fmt.Errorf("key_template: %v", err)
+		}
+		r.key = t
+	}
+	return nil
+}
+
+func (r *Route) match(info RouteInfo) bool {
+	return matchList(r.Team, info.Team) && matchList(r.Env, info.Env) && matchList(r.Ka, info.Ka) &&
+		matchList(r.Kind, info.Kind) &&
+		(r.app == nil || r.app.MatchString(info.App))
+}
+
+func renderKey(t *template.Template, info RouteInfo) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, info); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(buf.String(), "/"), nil
+}
+
+// Key 渲染对象名
+func (r *Route) Key(info RouteInfo) (string, error) {
+	t := r.key
+	if t == nil {
+		t = defaultKeyTmpl
+	}
+	key, err := renderKey(t, info)
+	if err != nil {
+		return "", err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("route %s: key template renders to invalid key %q", r.Name, key)
+	}
+	return key, nil
+}
+
+// KeyPrefix 对象名所在的目录，用于清理残留的分片上传
+func KeyPrefix(key string) string {
+	dir := path.Dir(key)
+	if dir == "." {
+		return ""
+	}
+	return dir + "/"
+}
+
+// ChannelConfig 一个命名的通知渠道
+type ChannelConfig struct {
+	Type      string            `json:"type"`    // dingtalk、wecom、feishu、slack、webhook、alertmanager
+	Webhook   string            `json:"webhook"` // 机器人webhook或通用webhook地址
+	Secret    string            `json:"secret"`  // 钉钉加签、飞书签名的密钥
+	At        []string          `json:"at"`      // 钉钉需要@的手机号
+	Headers   map[string]string `json:"headers"` // 通用webhook附加的请求头
+	URLs      []string          `json:"urls"`    // Alertmanager地址
+	EndsAfter string            `json:"ends_after"`
+}
+
+// NewNotifier 按渠道类型创建Notifier
+func NewNotifier(c ChannelConfig, ts *Templates) (Notifier, error) {
+	switch c.Type {
+	case "dingtalk":
+		return DingTalkNotifier{Robot: dingtalk.NewRobot(c.Webhook, c.Secret, c.At, false), Templates: ts}, nil
+	case "wecom":
+		return WeComNotifier{Robot: wecom.NewRobot(c.Webhook), Templates: ts}, nil
+	case "feishu":
+		return FeishuNotifier{Robot: feishu.NewRobot(c.Webhook, c.Secret), Templates: ts}, nil
+	case "slack":
+		return SlackNotifier{Webhook: slack.NewWebhook(c.Webhook), Templates: ts}, nil
+	case "webhook":
+		return WebhookNotifier{Webhook: webhook.New(c.Webhook, c.Headers)}, nil
+	case "alertmanager":
+		if len(c.URLs) == 0 {
+			return nil, fmt.Errorf("alertmanager channel needs urls")
+		}
+		var endsAfter time.Duration
+		if c.EndsAfter != "" {
+			d, err := time.ParseDuration(c.EndsAfter)
+			if err != nil {
+				return nil, fmt.Errorf("ends_after: %v", err)
+			}
+			endsAfter = d
+		}
+		return AlertmanagerNotifier{Client: alertmanager.NewClient(c.URLs), EndsAfter: endsAfter, Templates: ts}, nil
+	}
+	return nil, fmt.Errorf("unknown channel type %q", c.Type)
+}
+
+// RouteTable 按顺序匹配，第一条匹配的规则生效，都不匹配时使用Default
+type RouteTable struct {
+	Routes   []*Route
+	Default  *Route
+	channels map[string]Notifier
+}
+
+// NewRouteTable 编译规则、创建通知渠道，一次返回所有错误
+func NewRouteTable(routes []*Route, def *Route, channels map[string]ChannelConfig, ts *Templates) (*RouteTable, []error) {
+	if def == nil {
+		def = &Route{}
+	}
+	if def.Name == "" {
+		def.Name = "default"
+	}
+	rt := &RouteTable{Routes: routes, Default: def, channels: map[string]Notifier{}}
+	var errs []error
+	for name, c := range channels {
+		n, err := NewNotifier(c, ts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %v", name, err))
+			continue
+		}
+		rt.channels[name] = n
+	}
+	for i, r := range append([]*Route{def}, routes...) {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("route-%d", i)
+		}
+		if err := r.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %v", r.Name, err))
+		}
+		for _, n := range r.Notifiers {
+			if _, ok := channels[n]; !ok {
+				errs = append(errs, fmt.Errorf("route %s: unknown channel %q", r.Name, n))
+			}
+		}
+	}
+	return rt, errs
+}
+
+// Match 返回匹配的规则，目标为空的字段用默认路由补齐
+func (rt *RouteTable) Match(info RouteInfo) *Route {
+	for _, r := range rt.Routes {
+		if !r.match(info) {
+			continue
+		}
+		m := *r
+		if m.Target == "" {
+			m.Target = rt.Default.Target
+		}
+		if m.key == nil {
+			m.KeyTemplate, m.key = rt.Default.KeyTemplate, rt.Default.key
+		}
+		if len(m.Notifiers) == 0 {
+			m.Notifiers = rt.Default.Notifiers
+		}
+		return &m
+	}
+	return rt.Default
+}
+
+// Notifiers 规则对应的通知渠道，没有配置时返回nil
+func (rt *RouteTable) Notifiers(r *Route) []Notifier {
+	ns, _ := rt.Channels(r.Notifiers)
+	return ns
+}
+
+// Channels 按名字取channels中的通知渠道，返回不存在的渠道名
+func (rt *RouteTable) Channels(names []string) ([]Notifier, []string) {
+	var ns []Notifier
+	var missing []string
+	for _, name := range names {
+		if n, ok := rt.channels[name]; ok {
+			ns = append(ns, n)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	return ns, missing
+}
@@ -0,0 +1,79 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dump-handler/pkg/podname"
+)
+
+func TestRouteTable(t *testing.T) {
+	routes := []*Route{
+		{Name: "pay-prod", Team: "pay", Env: "prod", Target: "s3://pay-dumps", Notifiers: []string{"pay-ding"}},
+		{Name: "ops-api", Team: "ops,infra", App: "api|gateway", KeyTemplate: "{{.Team}}/{{.App}}/{{.Pod}}.hprof"},
+		{Name: "retail", Ka: "retail"},
+		{Name: "db-sts", Team: "db", Kind: "StatefulSet", KeyTemplate: "{{.Team}}/{{.Workload}}/{{.Ordinal}}-{{.Time}}"},
+	}
+	channels := map[string]ChannelConfig{
+		"pay-ding": {Type: "dingtalk", Webhook: "https://oapi.dingtalk.com/robot/send?access_token=x"},
+		"default":  {Type: "wecom", Webhook: "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=x"},
+	}
+	def := &Route{Target: "cos://bucket.cos.ap-beijing.myqcloud.com", Notifiers: []string{"default"}}
+	rt, errs := NewRouteTable(routes, def, channels, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		pod, ka, env string
+		route        string
+		target, key  string
+		channel      string
+	}{
+		{"pay-order-7d9f-x", "default", "prod", "pay-prod", "s3://pay-dumps", "default/prod/jvm/pay-order-7d9f-x-20210601120000", "dingtalk"},
+		{"pay-order-7d9f-x", "default", "test", "default", "cos://bucket.cos.ap-beijing.myqcloud.com", "default/test/jvm/pay-order-7d9f-x-20210601120000", "wecom"},
+		{"infra-gateway-1", "default", "test", "ops-api", "cos://bucket.cos.ap-beijing.myqcloud.com", "infra/gateway/infra-gateway-1.hprof", "wecom"},
+		// app正则整体匹配，apiserver不匹配api
+		{"ops-apiserver-1", "retail", "test", "retail", "cos://bucket.cos.ap-beijing.myqcloud.com", "retail/test/jvm/ops-apiserver-1-20210601120000", "wecom"},
+		// hash和序号不会出现在工作负载名中
+		{"db-mysql-2", "default", "test", "db-sts", "cos://bucket.cos.ap-beijing.myqcloud.com", "db/db-mysql/2-20210601120000", "wecom"},
+		{"db-mysql-7d9f8c6b5-x2kzq", "default", "test", "default", "cos://bucket.cos.ap-beijing.myqcloud.com", "default/test/jvm/db-mysql-7d9f8c6b5-x2kzq-20210601120000", "wecom"},
+	}
+	for _, c := range cases {
+		info := NewRouteInfo(podname.Parser{}.Parse(c.pod), c.ka, c.env, now)
+		r := rt.Match(info)
+		key, err := r.Key(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ns := rt.Notifiers(r)
+		if r.Name != c.route || r.Target != c.target || key != c.key || len(ns) != 1 || ns[0].Name() != c.channel {
+			t.Fatalf("%s/%s/%s: got route=%s target=%s key=%s notifiers=%v", c.pod, c.ka, c.env, r.Name, r.Target, key, ns)
+		}
+	}
+	if KeyPrefix("infra/gateway/x.hprof") != "infra/gateway/" || KeyPrefix("x") != "" {
+		t.Fatal("KeyPrefix")
+	}
+}
+
+func TestRouteTableErrors(t *testing.T) {
+	routes := []*Route{
+		{Name: "bad-re", App: "("},
+		{Name: "bad-key", KeyTemplate: "{{.Nope}}"},
+		{Name: "bad-channel", Notifiers: []string{"missing"}},
+	}
+	channels := map[string]ChannelConfig{"x": {Type: "pager"}}
+	_, errs := NewRouteTable(routes, nil, channels, nil)
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	joined := strings.Join(msgs, "\n")
+	for _, want := range []string{"route bad-re: app", "route bad-key: key_template", `unknown channel "missing"`, `channel x: unknown channel type "pager"`} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in:\n%s", want, joined)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"dump-handler/pkg/compress"
+	"dump-handler/pkg/envelope"
+	"dump-handler/pkg/spool"
+	"dump-handler/thirdparty/prom"
+	"dump-handler/thirdparty/storage"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+const (
+	SpoolUpload = "upload"
+	SpoolAlarm  = "alarm"
+)
+
+// UploadJob 上传失败的dump，dump文件保存在spool目录中
+type UploadJob struct {
+	Target        string            `json:"target"`
+	Key           string            `json:"key"`
+	PartSize      int64             `json:"part_size"`
+	Workers       int               `json:"workers"`
+	Codec         compress.Codec    `json:"codec"`
+	CompressLevel int               `json:"compress_level"`
+	Encrypted     bool              `json:"encrypted"`
+	Metadata      map[string]string `json:"metadata"`
+	Ka            string            `json:"ka"`
+	Env           string            `json:"env"`
+	Pod           string            `json:"pod"`
+	PodMeta       *PodMeta          `json:"pod_meta,omitempty"` // 重放时重新匹配路由、发送通知、上传清单
+}
+
+// AlarmJob 没有发送成功的告警
+type AlarmJob struct {
+	Points []prom.MetricPoint `json:"points"`
+}
+
+// SpoolUploadJob 记录上传失败的dump，dump文件链接或复制到spool目录
+func SpoolUploadJob(sp *spool.Spool, target, key, path string, opt UploadOptions, ka, env, pod string, meta *PodMeta) error {
+	job, err := sp.Put(SpoolUpload, UploadJob{
+		Target:        target,
+		Key:           key,
+		PartSize:      opt.PartSize,
+		Workers:       opt.Workers,
+		Codec:         opt.Codec,
+		CompressLevel: opt.CompressLevel,
+		Encrypted:     opt.Encryption != nil,
+		Metadata:      opt.Metadata,
+		Ka:            ka,
+		Env:           env,
+		Pod:           pod,
+		PodMeta:       meta,
+	}, path)
+	if err != nil {
+		return err
+	}
+	logger.Infof("[spool][upload][id:%s][key:%s][path:%s]", job.ID, key, sp.DataPath(job))
+	return nil
+}
+
+// SpoolAlarmJob 记录没有发送成功的告警
+func SpoolAlarmJob(sp *spool.Spool, points []prom.MetricPoint) error {
+	job, err := sp.Put(SpoolAlarm, AlarmJob{Points: points}, "")
+	if err != nil {
+		return err
+	}
+	logger.Infof("[spool][alarm][id:%s][points:%d]", job.ID, len(points))
+	return nil
+}
+
+// DrainOptions 重放spool时用的凭证、主密钥和普罗
+type DrainOptions struct {
+	Credential   storage.Credential
+	Encryption   envelope.KeyWrapper
+	Prom         *prom.DataSource // 为nil时只重放上传，告警任务保留
+	PromDisabled bool             // 没有配置普罗：告警任务直接丢弃，上传成功也不再记为告警任务
+	FlushTimeout time.Duration
+	// Finish 上传成功后上传清单、发送通知，返回要发送的普罗告警，与直接上传时相同；为nil时只生成告警
+	Finish func(ctx context.Context, job UploadJob, backend storage.Backend, key string, size int64) prom.MetricPoint
+}
+
+// DrainResult 重放的统计
+type DrainResult struct {
+	Done   int
+	Failed int
+}
+
+func failJob(sp *spool.Spool, job *spool.Job, err error, res *DrainResult) {
+	res.Failed++
+	job.Attempts++
+	job.LastError = err.Error()
+	logger.Errorf("[spool][drain_failed][id:%s][kind:%s][attempts:%d][err:%v]", job.ID, job.Kind, job.Attempts, err)
+	if uerr := sp.Update(job); uerr != nil {
+		logger.Errorf("[spool][update_failed][id:%s][err:%v]", job.ID, uerr)
+	}
+}
+
+func doneJob(sp *spool.Spool, job *spool.Job, res *DrainResult) {
+	res.Done++
+	logger.Infof("[spool][drain_done][id:%s][kind:%s]", job.ID, job.Kind)
+	if err := sp.Remove(job); err != nil {
+		logger.Errorf("[spool][remove_failed][id:%s][err:%v]", job.ID, err)
+	}
+}
+
+func drainUpload(ctx context.Context, sp *spool.Spool, job *spool.Job, opt DrainOptions) (prom.MetricPoint, error) {
+	var uj UploadJob
+	if err := json.Unmarshal(job.Payload, &uj); err != nil {
+		return prom.MetricPoint{}, err
+	}
+	if uj.Encrypted && opt.Encryption == nil {
+		return prom.MetricPoint{}, fmt.Errorf("%s was spooled with encryption, master key is required", uj.Key)
+	}
+	uploadOpts := UploadOptions{PartSize: uj.PartSize, Workers: uj.Workers, Codec: uj.Codec, CompressLevel: uj.CompressLevel, Metadata: uj.Metadata}
+	if uj.Encrypted {
+		uploadOpts.Encryption = opt.Encryption
+	}
+	backend, err := storage.New(uj.Target, opt.Credential)
+	if err != nil {
+		return prom.MetricPoint{}, err
+	}
+	key, err := UploadDump(ctx, backend, uj.Key, sp.DataPath(job), uploadOpts)
+	if err != nil {
+		return prom.MetricPoint{}, err
+	}
+	if opt.Finish == nil {
+		return NewAlarm(backend.URL(), key, uj.Ka, uj.Env), nil
+	}
+	var size int64
+	if fi, err := os.Stat(sp.DataPath(job)); err == nil {
+		size = fi.Size()
+	}
+	return opt.Finish(ctx, uj, backend, key, size), nil
+}
+
+// Drain 重放spool中的任务：先上传dump，再把上传成功产生的告警和之前没有发出的告警一起发送；
+// 成功的任务删除，失败的记录重试次数和错误后保留
+func Drain(ctx context.Context, sp *spool.Spool, opt DrainOptions) (DrainResult, error) {
+	var res DrainResult
+	jobs, err := sp.Jobs()
+	if err != nil {
+		return res, err
+	}
+	var (
+		uploaded  []prom.MetricPoint // 本次上传成功产生的告警
+		points    []prom.MetricPoint // 之前没有发出的告警
+		alarmJobs []*spool.Job
+	)
+	for _, job := range jobs {
+		switch job.Kind {
+		case SpoolUpload:
+			p, err := drainUpload(ctx, sp, job, opt)
+			if err != nil {
+				failJob(sp, job, err, &res)
+				continue
+			}
+			uploaded = append(uploaded, p)
+			doneJob(sp, job, &res)
+		case SpoolAlarm:
+			var aj AlarmJob
+			if err := json.Unmarshal(job.Payload, &aj); err != nil {
+				failJob(sp, job, err, &res)
+				continue
+			}
+			// 太旧的样本会被普罗拒绝(out of bounds)，重放时使用当前时间
+			for _, p := range aj.Points {
+				p.Time = time.Now().Unix()
+				points = append(points, p)
+			}
+			alarmJobs = append(alarmJobs, job)
+		default:
+			logger.Warningf("[spool][unknown_kind][id:%s][kind:%s]", job.ID, job.Kind)
+		}
+	}
+	if opt.PromDisabled {
+		for _, job := range alarmJobs {
+			logger.Warningf("[spool][alarm_dropped][id:%s] prometheus not configured", job.ID)
+			doneJob(sp, job, &res)
+		}
+		return res, nil
+	}
+	points = append(points, uploaded...)
+	if len(points) == 0 {
+		return res, nil
+	}
+
+	var sendErr error
+	if opt.Prom == nil {
+		sendErr = fmt.Errorf("prometheus not configured")
+	} else if sendErr = opt.Prom.RemoteWrite(points); sendErr == nil {
+		sendErr = FlushAlarm(opt.Prom, opt.FlushTimeout)
+	}
+	if sendErr == nil {
+		for _, job := range alarmJobs {
+			doneJob(sp, job, &res)
+		}
+		return res, nil
+	}
+	for _, job := range alarmJobs {
+		failJob(sp, job, sendErr, &res)
+	}
+	// 本次上传成功产生的告警没有发出，记为新的告警任务
+	if len(uploaded) > 0 {
+		if err := SpoolAlarmJob(sp, uploaded); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
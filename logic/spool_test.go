@@ -0,0 +1,118 @@
+package logic
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dump-handler/pkg/spool"
+	"dump-handler/thirdparty/prom"
+	"dump-handler/thirdparty/storage"
+)
+
+func newTestProm(t *testing.T, url string) *prom.DataSource {
+	pd := prom.NewPromDataSource(prom.Section{RemoteWrite: []prom.RemoteConfig{
+		{Name: "test", Url: url, RemoteTimeoutSecond: 5, RetryMaxAttempts: 1},
+	}})
+	if err := pd.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return pd
+}
+
+func TestDrain(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := spool.Open(filepath.Join(dir, "spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(dir, "oom")
+	ioutil.WriteFile(dump, []byte("heap"), 0644)
+	target := "file://" + filepath.Join(dir, "bucket")
+	meta := &PodMeta{Namespace: "default", Name: "pod"}
+	if err := SpoolUploadJob(sp, target, "ka/env/jvm/pod", dump, UploadOptions{}, "ka", "env", "pod", meta); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟emptyDir被清理
+	os.Remove(dump)
+
+	var up int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// 普罗不可用：dump上传成功，告警记为新任务
+	var finished UploadJob
+	finish := func(_ context.Context, job UploadJob, b storage.Backend, key string, size int64) prom.MetricPoint {
+		finished = job
+		if size != 4 {
+			t.Errorf("size %d", size)
+		}
+		return NewAlarm(b.URL(), key, job.Ka, job.Env)
+	}
+	res, err := Drain(context.Background(), sp, DrainOptions{Prom: newTestProm(t, srv.URL), FlushTimeout: 5 * time.Second, Finish: finish})
+	if err != nil || res.Done != 1 {
+		t.Fatalf("first drain: %+v %v", res, err)
+	}
+	if finished.Pod != "pod" || finished.PodMeta == nil || finished.PodMeta.Namespace != "default" {
+		t.Fatalf("finish not called with the spooled pod: %+v", finished)
+	}
+	backend, _ := storage.New(target, storage.Credential{})
+	if _, err := backend.Stat(context.Background(), "ka/env/jvm/pod"); err != nil {
+		t.Fatalf("dump not uploaded: %v", err)
+	}
+	jobs, _ := sp.Jobs()
+	if len(jobs) != 1 || jobs[0].Kind != SpoolAlarm {
+		t.Fatalf("expected one alarm job, got %+v", jobs)
+	}
+
+	// 普罗仍不可用：告警任务保留并记录重试次数
+	Drain(context.Background(), sp, DrainOptions{Prom: newTestProm(t, srv.URL), FlushTimeout: 5 * time.Second})
+	jobs, _ = sp.Jobs()
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LastError == "" {
+		t.Fatalf("expected alarm job kept with attempts, got %+v", jobs)
+	}
+
+	atomic.StoreInt32(&up, 1)
+	res, err = Drain(context.Background(), sp, DrainOptions{Prom: newTestProm(t, srv.URL), FlushTimeout: 5 * time.Second})
+	if err != nil || res.Done != 1 || res.Failed != 0 {
+		t.Fatalf("last drain: %+v %v", res, err)
+	}
+	if jobs, _ = sp.Jobs(); len(jobs) != 0 {
+		t.Fatalf("spool not empty: %+v", jobs)
+	}
+	if files, _ := ioutil.ReadDir(sp.Dir()); len(files) != 0 {
+		t.Fatalf("leftover files in spool: %d", len(files))
+	}
+}
+
+func TestDrainPromDisabled(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := spool.Open(filepath.Join(dir, "spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(dir, "oom")
+	ioutil.WriteFile(dump, []byte("heap"), 0644)
+	target := "file://" + filepath.Join(dir, "bucket")
+	SpoolUploadJob(sp, target, "ka/env/jvm/pod", dump, UploadOptions{}, "ka", "env", "pod", nil)
+	SpoolAlarmJob(sp, []prom.MetricPoint{NewAlarm(target, "ka/env/jvm/old", "ka", "env")})
+
+	// 没有配置普罗：dump照常上传，告警任务丢弃，不产生新的告警任务
+	res, err := Drain(context.Background(), sp, DrainOptions{PromDisabled: true})
+	if err != nil || res.Done != 2 || res.Failed != 0 {
+		t.Fatalf("drain: %+v %v", res, err)
+	}
+	if jobs, _ := sp.Jobs(); len(jobs) != 0 {
+		t.Fatalf("spool not empty: %+v", jobs)
+	}
+}
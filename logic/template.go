@@ -0,0 +1,153 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+// 内置模板，自定义模板文件中用同名的define覆盖。渲染某个渠道时先找"<渠道>.title"、"<渠道>.body"，
+// 没有定义时使用通用的"title"、"body"。可用的数据见OOMDumpEvent:
+//
+//	.Pod .App .Team .Ka .Env .Hostname  pod及所在的项目组、app、租户、环境、执行上传的主机
+//	.Key .Size                          对象名、dump文件大小(字节，可用humanBytes格式化)
+//	.ObjectURL .Link                    对象地址、预签名下载地址
+//	.Summary                            hprof文件头和校验结果的摘要，不是hprof时为空
+//	.Exe .Signal                        core dump的可执行文件名和信号，OOM时为空
+//	.Samples                            线程dump的抓取次数，其他dump为0
+//	.Artifacts                          附属文件，每项有.Name .Key .Size .Truncated .Link
+const defaultTemplates = `
+{{define "kind"}}{{if .Signal}}{{.Exe}} {{.Signal}} core dump{{else if .Samples}}JVM thread dump x{{.Samples}}{{else}}JVM OOM{{end}}{{end}}
+
+{{define "title"}}[{{.Ka}}/{{.Env}}] {{.Pod}} {{if .Signal}}{{.Exe}} {{.Signal}}{{else if .Samples}}thread dump{{else}}OOM{{end}}{{end}}
+
+{{define "body"}}### {{template "kind" .}}: {{.Pod}}
+
+- 租户: {{.Ka}}
+- 环境: {{.Env}}
+- 项目组: {{.Team}}
+- App: {{.App}}
+- Pod: {{.Pod}}
+- dump: {{.Key}} ({{humanBytes .Size}})
+{{- range .Artifacts}}
+- {{.Name}}: [{{.Key}}]({{.Link}}) ({{humanBytes .Size}}{{if .Truncated}}，末尾{{end}})
+{{- end}}
+{{- if .Summary}}
+
+{{.Summary}}
+{{- end}}
+
+[下载dump]({{.Link}}){{end}}
+
+{{define "feishu.body"}}**{{template "kind" .}}: {{.Pod}}**
+租户: {{.Ka}}
+环境: {{.Env}}
+项目组: {{.Team}}
+App: {{.App}}
+Pod: {{.Pod}}
+dump: {{.Key}} ({{humanBytes .Size}})
+{{- range .Artifacts}}
+{{.Name}}: [{{.Key}}]({{.Link}}) ({{humanBytes .Size}}{{if .Truncated}}，末尾{{end}})
+{{- end}}
+{{- if .Summary}}
+{{.Summary}}
+{{- end}}
+[下载dump]({{.Link}}){{end}}
+
+{{define "slack.body"}}*{{template "kind" .}}: {{.Pod}}*
+• ka: {{.Ka}}
+• env: {{.Env}}
+• team/app: {{.Team}}/{{.App}}
+• dump: ` + "`{{.Key}}`" + ` ({{humanBytes .Size}})
+{{- range .Artifacts}}
+• <{{.Link}}|{{.Name}}> ({{humanBytes .Size}}{{if .Truncated}}, tail{{end}})
+{{- end}}
+{{- if .Summary}}
+{{.Summary}}
+{{- end}}
+<{{.Link}}|download dump>{{end}}
+
+{{define "alertmanager.summary"}}{{.Pod}} {{if .Signal}}{{.Exe}} crashed with {{.Signal}}, core dump{{else if .Samples}}{{.Samples}} thread dump samples{{else}}OOM, heap dump{{end}} uploaded ({{humanBytes .Size}}){{end}}
+
+{{define "alertmanager.description"}}{{.Key}}{{range .Artifacts}}
+{{.Key}}{{end}}{{if .Summary}}
+{{.Summary}}{{end}}{{end}}
+`
+
+// humanBytes 1536 -> 1.5KiB
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var templateFuncs = template.FuncMap{
+	"humanBytes": humanBytes,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+}
+
+// Templates 通知消息和告警注解的模板
+type Templates struct {
+	t *template.Template
+}
+
+// ParseTemplates 在内置模板的基础上解析text，text中的define覆盖同名的内置模板
+func ParseTemplates(text string) (*Templates, error) {
+	t, err := template.New("default").Funcs(templateFuncs).Parse(defaultTemplates)
+	if err != nil {
+		return nil, err
+	}
+	if text != "" {
+		if t, err = t.New("custom").Parse(text); err != nil {
+			return nil, err
+		}
+	}
+	return &Templates{t: t}, nil
+}
+
+// LoadTemplates 从文件加载自定义模板，path为空时只有内置模板
+func LoadTemplates(path string) (*Templates, error) {
+	if path == "" {
+		return ParseTemplates("")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := ParseTemplates(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %v", path, err)
+	}
+	return t, nil
+}
+
+var defaultTmpl, _ = ParseTemplates("")
+
+// Render 渲染"<channel>.<name>"，没有定义时渲染通用的name
+func (ts *Templates) Render(channel, name string, e OOMDumpEvent) (string, error) {
+	if ts == nil {
+		ts = defaultTmpl
+	}
+	t := ts.t.Lookup(channel + "." + name)
+	if t == nil {
+		t = ts.t.Lookup(name)
+	}
+	if t == nil {
+		return "", fmt.Errorf("template %s.%s not defined", channel, name)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, e); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,59 @@
+package logic
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	e := OOMDumpEvent{Pod: "ops-demo-1", Team: "ops", App: "demo", Ka: "ka", Env: "prod", Key: "ka/prod/jvm/ops-demo-1", Size: 3 << 30, Link: "https://x"}
+
+	// 内置模板
+	body, err := (*Templates)(nil).Render("dingtalk", "body", e)
+	if err != nil || !strings.Contains(body, "3.0GiB") || !strings.Contains(body, "[下载dump](https://x)") {
+		t.Fatalf("default body: %q %v", body, err)
+	}
+	if body, _ := (*Templates)(nil).Render("slack", "body", e); !strings.Contains(body, "<https://x|download dump>") {
+		t.Fatalf("slack body: %q", body)
+	}
+	// 飞书卡片的markdown不支持标题
+	if body, _ := (*Templates)(nil).Render("feishu", "body", e); strings.Contains(body, "#") || !strings.HasPrefix(body, "**JVM OOM: ops-demo-1**") {
+		t.Fatalf("feishu body: %q", body)
+	}
+	ea := e
+	ea.Artifacts = []Artifact{{Name: "stdout.log", Key: "ka/prod/jvm/ops-demo-1.stdout.log", Size: 2048, Truncated: true, Link: "https://y"}}
+	if body, _ := (*Templates)(nil).Render("dingtalk", "body", ea); !strings.Contains(body, "- stdout.log: [ka/prod/jvm/ops-demo-1.stdout.log](https://y) (2.0KiB，末尾)") {
+		t.Fatalf("artifacts body: %q", body)
+	}
+
+	// 自定义模板覆盖通用的title和钉钉的正文，其他渠道沿用内置
+	path := filepath.Join(t.TempDir(), "msg.tmpl")
+	ioutil.WriteFile(path, []byte(`{{define "title"}}{{upper .Env}} {{.App}}{{end}}
+{{define "dingtalk.body"}}{{.Team}}: {{.Pod}}{{if .Summary}} {{.Summary}}{{end}}{{end}}`), 0644)
+	ts, err := LoadTemplates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title, _ := ts.Render("feishu", "title", e); title != "PROD demo" {
+		t.Fatalf("custom title: %q", title)
+	}
+	if body, _ := ts.Render("dingtalk", "body", e); body != "ops: ops-demo-1" {
+		t.Fatalf("custom dingtalk body: %q", body)
+	}
+	if body, _ := ts.Render("wecom", "body", e); !strings.HasPrefix(body, "### JVM OOM") {
+		t.Fatalf("wecom should fall back to default body: %q", body)
+	}
+
+	if _, err := ParseTemplates(`{{define "title"}}{{.Nope}}{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTemplates(`{{define "title"}}{{.Pod}{{end}}`); err == nil {
+		t.Fatal("expected parse error")
+	}
+	bad, _ := ParseTemplates(`{{define "title"}}{{.Nope}}{{end}}`)
+	if _, err := bad.Render("x", "title", e); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
@@ -0,0 +1,20 @@
+package logic
+
+import (
+	"strconv"
+	"time"
+
+	"dump-handler/thirdparty/prom"
+)
+
+const BIZ_THREAD_DUMP = "biz_thread_dump"
+
+// DefaultThreadKeyTemplate 线程dump的对象名模板
+const DefaultThreadKeyTemplate = "{{.Ka}}/{{.Env}}/threads/{{.Pod}}-{{.Time}}"
+
+// NewThreadDumpAlarm 线程dump上传成功的告警，比biz_oom_dump多samples标签
+func NewThreadDumpAlarm(cosUrl, fileName, ka, env string, samples int) prom.MetricPoint {
+	tags := newOOMDumpTags(cosUrl, fileName, ka, env)
+	tags["samples"] = strconv.Itoa(samples)
+	return *prom.NewMetricPoint(BIZ_THREAD_DUMP, tags, time.Now().Unix(), float64(1))
+}
@@ -0,0 +1,165 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"dump-handler/pkg/compress"
+	"dump-handler/pkg/envelope"
+	"dump-handler/thirdparty/storage"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// UploadOptions dump文件的上传参数
+type UploadOptions struct {
+	PartSize      int64               // 分片大小
+	Workers       int                 // 并发上传的分片数
+	Codec         compress.Codec      // 压缩算法
+	CompressLevel int                 // 压缩级别，0为默认
+	Encryption    envelope.KeyWrapper // 不为nil时客户端加密后再上传
+	Metadata      map[string]string   // 对象的自定义元数据，如pod信息
+}
+
+// UploadDump 上传dump文件，返回实际写入的对象名
+// 不压缩不加密时走分片断点续传，容器重启后沿用上一次的对象名；
+// 否则边读边压缩、加密流式上传，对象名依次加上压缩后缀和.enc，中断后只能从头上传
+func UploadDump(ctx context.Context, backend storage.Backend, key, path string, opt UploadOptions) (string, error) {
+	if (opt.Codec == "" || opt.Codec == compress.None) && opt.Encryption == nil {
+		putOpts := &storage.PutOptions{PartSize: opt.PartSize, Workers: opt.Workers, Metadata: opt.Metadata}
+		if k, ok := storage.ResumeKey(path, backend.URL()); ok {
+			logger.Infof("[upload_dump][resume][path:%s][key:%s]", path, k)
+			key = k
+		}
+		return key, storage.PutFile(ctx, backend, key, path, putOpts)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return UploadStream(ctx, backend, key, f, opt)
+}
+
+// UploadStream 边读边压缩、加密流式上传r，对象名依次加上压缩后缀和.enc，返回实际写入的对象名
+func UploadStream(ctx context.Context, backend storage.Backend, key string, src io.Reader, opt UploadOptions) (string, error) {
+	if opt.Codec == "" {
+		opt.Codec = compress.None
+	}
+	putOpts := &storage.PutOptions{PartSize: opt.PartSize, Workers: opt.Workers, Metadata: map[string]string{}}
+	for k, v := range opt.Metadata {
+		putOpts.Metadata[k] = v
+	}
+	key += opt.Codec.Extension()
+	// 不设置Content-Encoding，否则浏览器、curl下载时会自动解压，落地的.gz文件实际是未压缩内容
+	putOpts.ContentType = opt.Codec.ContentType()
+	putOpts.Metadata["codec"] = string(opt.Codec)
+	var r io.ReadCloser = compress.Reader(src, opt.Codec, opt.CompressLevel)
+	defer r.Close()
+	if opt.Encryption != nil {
+		key += envelope.Extension
+		putOpts.ContentType = "application/octet-stream"
+		putOpts.Metadata["encryption"] = envelope.Algorithm
+		r = envelope.Reader(ctx, r, opt.Encryption)
+		defer r.Close()
+	}
+	return key, storage.PutStream(ctx, backend, key, r, putOpts)
+}
+
+// readCloser Close时依次关闭解压器、解密器和对象的body
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r readCloser) Close() error {
+	var first error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// OpenDump 下载UploadDump上传的对象，按对象名后缀依次解密、解压，返回原始的dump内容；
+// Close时释放解压器(zstd的后台goroutine)、解密器并关闭body
+func OpenDump(ctx context.Context, backend storage.Backend, key string, kw envelope.KeyWrapper) (io.ReadCloser, error) {
+	body, err := backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = body
+	closers := []io.Closer{body}
+	name := key
+	if strings.HasSuffix(name, envelope.Extension) {
+		if kw == nil {
+			body.Close()
+			return nil, fmt.Errorf("%s is encrypted, master key is required", key)
+		}
+		if r, err = envelope.NewReader(ctx, r, kw); err != nil {
+			body.Close()
+			return nil, err
+		}
+		if c, ok := r.(io.Closer); ok {
+			closers = append([]io.Closer{c}, closers...)
+		}
+		name = strings.TrimSuffix(name, envelope.Extension)
+	}
+	for _, c := range []compress.Codec{compress.Gzip, compress.Zstd} {
+		if strings.HasSuffix(name, c.Extension()) {
+			dr, err := compress.NewReader(r, c)
+			if err != nil {
+				readCloser{closers: closers}.Close()
+				return nil, err
+			}
+			return readCloser{dr, append([]io.Closer{dr}, closers...)}, nil
+		}
+	}
+	return readCloser{r, closers}, nil
+}
+
+// AbortKeyUploads key上传完成后放弃同一个对象残留的分片上传(如被丢弃的断点)，
+// 不影响其他pod的上传；后端不支持分片时什么也不做
+func AbortKeyUploads(ctx context.Context, backend storage.Backend, key string) {
+	m, ok := backend.(storage.Multipart)
+	if !ok {
+		return
+	}
+	uploads, err := m.ListMultipartUploads(ctx, key)
+	if err != nil {
+		logger.Warningf("[abort_key_uploads_error][key:%s][err:%v]", key, err)
+		return
+	}
+	for _, u := range uploads {
+		if u.Key != key {
+			continue
+		}
+		if err := m.AbortMultipartUpload(ctx, u.Key, u.UploadID); err != nil {
+			logger.Warningf("[abort_key_uploads_error][key:%s][upload_id:%s][err:%v]", key, u.UploadID, err)
+			continue
+		}
+		logger.Infof("[abort_key_uploads][key:%s][upload_id:%s]", key, u.UploadID)
+	}
+}
+
+// AbortOrphanUploads 放弃prefix下发起时间早于olderThan的分片上传，keep中的uploadId(本地、spool的断点)除外；
+// 后端不支持分片时什么也不做
+func AbortOrphanUploads(ctx context.Context, backend storage.Backend, prefix string, olderThan time.Duration, keep ...string) {
+	m, ok := backend.(storage.Multipart)
+	if !ok || olderThan <= 0 {
+		return
+	}
+	n, err := storage.AbortOrphanUploads(ctx, m, prefix, olderThan, keep...)
+	if err != nil {
+		logger.Warningf("[abort_orphan_uploads_error][prefix:%s][err:%v]", prefix, err)
+	}
+	if n > 0 {
+		logger.Infof("[abort_orphan_uploads][prefix:%s][aborted:%d]", prefix, n)
+	}
+}
@@ -0,0 +1,98 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dump-handler/pkg/compress"
+	"dump-handler/pkg/envelope"
+	"dump-handler/thirdparty/storage"
+)
+
+func TestUploadDumpRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := storage.New("file://"+filepath.Join(dir, "bucket"), storage.Credential{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "oom")
+	data := bytes.Repeat([]byte("JAVA PROFILE 1.0.2 token=abc "), 5000)
+	ioutil.WriteFile(path, data, 0644)
+	kw, _ := envelope.NewLocalKey(bytes.Repeat([]byte{3}, 32))
+
+	cases := []struct {
+		opt    UploadOptions
+		suffix string
+	}{
+		{UploadOptions{}, "pod"},
+		{UploadOptions{Codec: compress.Zstd}, "pod.zst"},
+		{UploadOptions{Codec: compress.Gzip, Encryption: kw}, "pod.gz.enc"},
+		{UploadOptions{Encryption: kw}, "pod.enc"},
+	}
+	for _, c := range cases {
+		key, err := UploadDump(context.Background(), backend, "ka/env/jvm/pod", path, c.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(key, c.suffix) {
+			t.Fatalf("key %s should end with %s", key, c.suffix)
+		}
+		r, err := OpenDump(context.Background(), backend, key, kw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: round trip mismatch, err=%v", key, err)
+		}
+	}
+	if _, err := OpenDump(context.Background(), backend, "ka/env/jvm/pod.enc", nil); err == nil {
+		t.Fatal("expected error when opening encrypted dump without key")
+	}
+
+	// Close关闭解压器和对象的body
+	tb := &closeTracker{Backend: backend}
+	key, err := UploadDump(context.Background(), backend, "ka/env/jvm/closed", path, UploadOptions{Codec: compress.Zstd, Encryption: kw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenDump(context.Background(), tb, key, kw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil || tb.closed != 1 {
+		t.Fatalf("body not closed: closed=%d err=%v", tb.closed, err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err == nil {
+		t.Fatal("decoder should be closed")
+	}
+}
+
+type closeTracker struct {
+	storage.Backend
+	closed int
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	t *closeTracker
+}
+
+func (b trackedBody) Close() error {
+	b.t.closed++
+	return b.ReadCloser.Close()
+}
+
+func (t *closeTracker) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := t.Backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return trackedBody{rc, t}, nil
+}
@@ -1,47 +1,224 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"dump-handler/logic"
-	"dump-handler/thirdparty/cos"
+	"dump-handler/pkg/dumpfile"
+	"dump-handler/pkg/envelope"
+	"dump-handler/pkg/podname"
+	"dump-handler/pkg/secrets"
+	"dump-handler/pkg/spool"
+	"dump-handler/pkg/threaddump"
+	"dump-handler/pkg/watch"
+	"dump-handler/thirdparty/alertmanager"
+	_ "dump-handler/thirdparty/cos"
+	"dump-handler/thirdparty/dingtalk"
+	"dump-handler/thirdparty/feishu"
+	"dump-handler/thirdparty/k8s"
+	_ "dump-handler/thirdparty/oss"
 	"dump-handler/thirdparty/prom"
+	_ "dump-handler/thirdparty/s3"
+	"dump-handler/thirdparty/slack"
+	"dump-handler/thirdparty/storage"
+	"dump-handler/thirdparty/webhook"
+	"dump-handler/thirdparty/wecom"
 
 	"github.com/toolkits/pkg/logger"
 )
 
 var (
 	// 普罗
-	promUrl string //普罗地址
-	env     string //部署环境
-	ka      string //租户
-	// cos
-	cosUrl    string //OSS url
-	secretID  string //OSS secret_id
-	secretKey string //OSS secret_key
-
-	podId        string //PodId
-	postfix      string //文件名的时间后缀
+	promUrl      string        //普罗地址
+	flushTimeout time.Duration //退出前等待告警发送的最长时间
+	env          string        //部署环境
+	ka           string        //租户
+	// 对象存储
+	target      string        //存储地址，按scheme选择后端
+	partSize    int64         //分片大小
+	partWorkers int           //并发上传的分片数
+	orphanAge   time.Duration //超过该时长未完成的分片上传视为残留并放弃
+	codec       string        //压缩算法
+	level       int           //压缩级别
+	// 等待dump写完
+	stableOpts dumpfile.StableOptions
+	// 客户端加密
+	keyFile  string //本地主密钥文件
+	kmsUrl   string //KMS地址
+	kmsKeyID string //KMS主密钥ID
+	kmsToken string //KMS访问token
+	// 通知渠道
+	dingWebhook     string        //钉钉机器人webhook
+	dingSecret      string        //钉钉加签密钥
+	dingAt          string        //钉钉需要@的手机号，逗号分隔
+	wecomWebhook    string        //企业微信机器人webhook
+	feishuWebhook   string        //飞书机器人webhook
+	feishuSecret    string        //飞书签名密钥
+	slackWebhook    string        //Slack incoming webhook
+	webhookUrl      string        //通用JSON webhook
+	alertmanagerUrl string        //Alertmanager地址，逗号分隔
+	alertEndsAfter  time.Duration //Alertmanager告警的持续时间
+	templateFile    string        //自定义消息模板文件
+	linkExpire      time.Duration //下载链接有效期
+	notifyTimeout   time.Duration //单个渠道的发送超时
+	// 路由
+	keyTemplate string //默认路由的对象名模板
+	// spool
+	spoolDir string //上传、告警失败时保存任务的目录
+	// download子命令
+	objectKey  string //要下载的对象名
+	outputPath string //下载后写入的本地文件
+	cosUrl     string //OSS url
+	secretID   string //OSS secret_id
+	secretKey  string //OSS secret_key
+	// 凭证的其他来源
+	secretIDFile    string //secret_id文件
+	secretKeyFile   string //secret_key文件
+	credentialsFile string //凭证JSON文件
+	secretsDir      string //Kubernetes secret挂载目录
+
+	podId string //PodId
+	// pod名解析
+	teamSegments int    //工作负载名的前几段是项目组
+	teams        string //带"-"的项目组，逗号分隔
+	// pod信息
+	k8sAPI         bool   //从API server读取pod信息
+	namespace      string //pod所在的namespace
+	downwardAPIDir string //downward API卷的挂载目录
+	container      string //JVM所在的容器名
+	alertPodLabels string //带到告警标签中的pod标签，逗号分隔
+	// 保留时长
+	retention      time.Duration //dump的保留时长，0为不过期
+	allowedBuckets string        //dump-handler.io/bucket注解允许使用的桶，逗号分隔
+	sharedNode     bool          //node、core模式，处理节点上所有pod的dump
+	// watch子命令
+	watchDir         string        //监听的目录
+	watchPatterns    string        //dump文件名的glob，逗号分隔
+	watchInterval    time.Duration //轮询间隔
+	watchInotify     bool          //是否使用inotify
+	watchAfter       string        //处理完之后重命名还是删除
+	watchMaxAttempts int           //连续失败多少次后不再处理
+	// node子命令
+	kubeletDir string //kubelet的--root-dir
+	nodeName   string //所在节点名
+	envVar     string //业务容器中表示部署环境的环境变量
+	// 附属文件
+	artifactGlobs   string        //与dump一起上传的文件，逗号分隔的glob
+	artifactMaxSize int64         //附属文件超过该大小时只上传末尾
+	artifactMaxAge  time.Duration //只上传dump之前该时长内修改的附属文件
+	// 线程dump
+	threadDumpPid      int           //抓取的JVM的pid，OOM时由-XX:OnOutOfMemoryError的%p传入
+	threadWaitParent   int           //等该父进程(OnOutOfMemoryError)退出后再抓取
+	threadDumpCount    int           //抓取次数
+	threadDumpInterval time.Duration //抓取间隔
+	threadDumpOutput   string        //SIGQUIT时JVM输出线程dump的文件
+	threadDumpTimeout  time.Duration //等待一次线程dump的最长时间
+	jcmdPath           string        //jcmd命令
+	threadKeyTemplate  string        //线程dump的对象名模板
+	// core子命令
+	coreKeyTemplate string //core的对象名模板
+	coreCompress    string //core的压缩算法
+	// prune子命令
+	prunePrefix  string //只清理该前缀下的对象
+	dryRun       bool   //只打印不删除
 	locaFilename string //OOM DumpFile
+	logLevel     string //日志级别
 )
 
 func init() {
+	flag.StringVar(&configFile, "config", "", "YAML or JSON config file, also "+EnvPrefix+"CONFIG; flags override env, env overrides the file")
+	flag.StringVar(&logLevel, "log-level", "DEBUG", "log level: DEBUG, INFO, WARNING, ERROR or FATAL")
 	// prom
-	flag.StringVar(&promUrl, "prom", "10.150.30.6:9090", "promUrl")
+	flag.StringVar(&promUrl, "prom", "", "prometheus host:port for the biz_oom_dump remote write, empty disables")
 	flag.StringVar(&env, "e", "test", "ENV")
 	flag.StringVar(&ka, "ka", "default", "KA")
+	flag.DurationVar(&flushTimeout, "flush-timeout", 10*time.Second, "wait at most this long for the alarm to reach prometheus before exit")
 	// oss
+	flag.StringVar(&target, "target", "", "storage target, e.g. cos://<bucket>.cos.<region>.myqcloud.com, oss://, s3://, file:///data/dumps; defaults to cosurl")
+	flag.Int64Var(&partSize, "part-size", 16*1024*1024, "multipart upload part size in bytes, at least 5MiB")
+	flag.IntVar(&partWorkers, "part-workers", 4, "number of parts uploaded in parallel")
+	flag.DurationVar(&orphanAge, "abort-orphans-after", 24*time.Hour, "prune: abort multipart uploads under -prefix older than this, except those in -spool-dir and -filepath checkpoints, 0 disables")
+	flag.StringVar(&codec, "compress", "none", "compress dump before upload: none, gzip, zstd; compressed uploads are streamed and cannot resume after a restart")
+	flag.IntVar(&level, "compress-level", 0, "compress level, gzip 1-9, zstd 1-22, 0 for default")
+	flag.DurationVar(&stableOpts.Interval, "stable-interval", dumpfile.DefaultStableOptions.Interval, "interval between dump size/mtime checks")
+	flag.IntVar(&stableOpts.Checks, "stable-checks", dumpfile.DefaultStableOptions.Checks, "consecutive unchanged checks before the dump is considered complete")
+	flag.DurationVar(&stableOpts.Timeout, "stable-timeout", dumpfile.DefaultStableOptions.Timeout, "give up if the dump is still changing after this long")
+	flag.BoolVar(&stableOpts.Validate, "validate-hprof", dumpfile.DefaultStableOptions.Validate, "check hprof header and records are complete before upload")
+	flag.StringVar(&keyFile, "encrypt-key-file", "", "encrypt dump with AES-256-GCM, data key wrapped by the 32-byte master key in this file; encrypted uploads are streamed and cannot resume")
+	flag.StringVar(&kmsUrl, "kms-url", "", "encrypt dump with AES-256-GCM, data key wrapped by this KMS endpoint; encrypted uploads are streamed and cannot resume")
+	flag.StringVar(&kmsKeyID, "kms-key-id", "", "master key id used with -kms-url")
+	flag.StringVar(&kmsToken, "kms-token", "", "bearer token used with -kms-url")
+	flag.StringVar(&dingWebhook, "dingtalk-webhook", "", "dingtalk robot webhook, e.g. https://oapi.dingtalk.com/robot/send?access_token=xxx, empty disables")
+	flag.StringVar(&dingSecret, "dingtalk-secret", "", "dingtalk robot sign secret (SEC...)")
+	flag.StringVar(&dingAt, "dingtalk-at", "", "comma separated mobiles to @ in the dingtalk message")
+	flag.StringVar(&wecomWebhook, "wecom-webhook", "", "wecom group robot webhook, e.g. https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=xxx")
+	flag.StringVar(&feishuWebhook, "feishu-webhook", "", "feishu/lark group robot webhook, e.g. https://open.feishu.cn/open-apis/bot/v2/hook/xxx")
+	flag.StringVar(&feishuSecret, "feishu-secret", "", "feishu/lark robot signature secret")
+	flag.StringVar(&slackWebhook, "slack-webhook", "", "slack incoming webhook url")
+	flag.StringVar(&webhookUrl, "webhook-url", "", "generic webhook, the event is POSTed as JSON")
+	flag.StringVar(&alertmanagerUrl, "alertmanager-url", "", "comma separated alertmanager urls, alerts are POSTed to <url>/api/v2/alerts")
+	flag.DurationVar(&alertEndsAfter, "alert-ends-after", time.Hour, "endsAt of alertmanager alerts, 0 leaves it to resolve_timeout")
+	flag.StringVar(&templateFile, "template-file", "", "go text/template file overriding the built-in notification templates")
+	flag.DurationVar(&linkExpire, "link-expire", 7*24*time.Hour, "expiry of the presigned download link in notifications")
+	flag.DurationVar(&notifyTimeout, "notify-timeout", 10*time.Second, "timeout of each notification channel")
+	flag.StringVar(&keyTemplate, "key-template", logic.DefaultKeyTemplate, "object key template of the default route, fields: .Ka .Env .Pod .Workload .Kind .Ordinal .Team .App .Time")
+	flag.StringVar(&spoolDir, "spool-dir", "", "save failed uploads and alarms here (hostPath or PVC) for the drain subcommand, empty disables")
+	flag.DurationVar(&retention, "retention", 0, "mark dumps with retain-until metadata for the prune subcommand, 0 keeps them forever")
+	flag.StringVar(&allowedBuckets, "allowed-buckets", "", "comma separated buckets the dump-handler.io/bucket annotation may choose, empty allows any in a pod and none in node and core mode")
+	flag.StringVar(&watchDir, "watch-dir", "", "watch: directory to watch, defaults to the directory of -filepath")
+	flag.StringVar(&watchPatterns, "watch-patterns", "", "watch: comma separated file name globs, defaults to *.hprof and the file name of -filepath")
+	flag.DurationVar(&watchInterval, "watch-interval", 10*time.Second, "watch: rescan interval, also the fallback when inotify is unavailable")
+	flag.BoolVar(&watchInotify, "watch-inotify", true, "watch: use inotify, disable on NFS and other filesystems without inotify support")
+	flag.StringVar(&watchAfter, "watch-after", watch.AfterRename, "watch: rename processed dumps to <name>.done (kept until removed by hand, repeated OOMs can fill a sized emptyDir), or delete them to free the space")
+	flag.IntVar(&watchMaxAttempts, "watch-max-attempts", 3, "watch: rename a dump to <name>.failed after this many failed attempts")
+	flag.StringVar(&kubeletDir, "kubelet-dir", k8s.DefaultKubeletDir, "node: kubelet root dir mounted from the host")
+	flag.StringVar(&nodeName, "node-name", "", "node: node to list pods on, defaults to NODE_NAME")
+	flag.StringVar(&envVar, "env-var", "ENV", "node: container env var holding the deploy env, falls back to -e")
+	flag.StringVar(&artifactGlobs, "artifacts", "hs_err_pid*.log,gc*.log*,stdout*.log", "comma separated globs of files uploaded with the dump, relative to the dump directory, newest match of each")
+	flag.Int64Var(&artifactMaxSize, "artifact-max-size", 10*1024*1024, "upload only the last bytes of artifacts larger than this, 0 uploads them whole")
+	flag.DurationVar(&artifactMaxAge, "artifact-max-age", time.Hour, "skip artifacts modified this long before the dump, 0 disables")
+	flag.IntVar(&threadDumpPid, "thread-dump-pid", 0, "JVM to capture; pass %p in -XX:OnOutOfMemoryError to capture in a detached process after the hook returns; threads: defaults to the first java process")
+	flag.IntVar(&threadWaitParent, "thread-dump-wait-parent", 0, "threads: wait until this parent process exits before capturing, set by the OnOutOfMemoryError hook")
+	flag.IntVar(&threadDumpCount, "thread-dump-count", 1, "number of thread dump samples, uploaded together as one object")
+	flag.DurationVar(&threadDumpInterval, "thread-dump-interval", 5*time.Second, "interval between thread dump samples")
+	flag.StringVar(&threadDumpOutput, "thread-dump-output", "", "file the JVM writes SIGQUIT thread dumps to, defaults to its stdout /proc/<pid>/fd/1")
+	flag.DurationVar(&threadDumpTimeout, "thread-dump-timeout", threaddump.DefaultOptions.Timeout, "wait at most this long for each thread dump")
+	flag.StringVar(&jcmdPath, "jcmd", threaddump.DefaultOptions.Jcmd, "jcmd used for Thread.print, falls back to SIGQUIT if missing or failing, empty always uses SIGQUIT")
+	flag.StringVar(&threadKeyTemplate, "thread-key-template", logic.DefaultThreadKeyTemplate, "thread dump object key template, fields as -key-template")
+	flag.StringVar(&coreKeyTemplate, "core-key-template", logic.DefaultCoreKeyTemplate, "core: object key template, fields as -key-template plus .Exe")
+	flag.StringVar(&coreCompress, "core-compress", "zstd", "core: compress core before upload: none, gzip, zstd")
+	flag.StringVar(&prunePrefix, "prefix", "", "prune: only objects under this prefix, e.g. ka/env/jvm/")
+	flag.BoolVar(&dryRun, "dry-run", false, "prune: only log expired dumps")
+	flag.StringVar(&objectKey, "object", "", "download: object key to download")
+	flag.StringVar(&outputPath, "o", "", "download: output file, defaults to stdout")
 	// cosurl: <BucketName-APPID>.cos.<Region>.myqcloud.com   注意这里包含了存储桶
-	flag.StringVar(&cosUrl, "cosurl", "https://release-retail-1253467224.cos.ap-beijing.myqcloud.com", "ossUrl")
-	flag.StringVar(&secretID, "secret", "AKIDc2C5h38xVnnX0C7mBI9j24pJXVCdngJe", "ossSecretID")
-	flag.StringVar(&secretKey, "secretkey", "6vTmoa5JGwMVMxHK6bqoWyB9rJVR5ScW", "ossSecretKey")
+	flag.StringVar(&cosUrl, "cosurl", "", "cos bucket url, e.g. https://<bucket>-<appid>.cos.<region>.myqcloud.com, used when -target is empty")
+	flag.StringVar(&secretID, "secret", "", "storage secret id, prefer -secret-file, -credentials-file or env since flags show up in ps")
+	flag.StringVar(&secretKey, "secretkey", "", "storage secret key, prefer -secretkey-file, -credentials-file or env since flags show up in ps")
+	flag.StringVar(&secretIDFile, "secret-file", "", "file containing the storage secret id")
+	flag.StringVar(&secretKeyFile, "secretkey-file", "", "file containing the storage secret key")
+	flag.StringVar(&credentialsFile, "credentials-file", "", `credentials JSON file, {"secret_id":"...","secret_key":"..."}`)
+	flag.StringVar(&secretsDir, "secrets-dir", "/var/run/secrets/dump-handler", "kubernetes secret mount with secret_id and secret_key files, skipped if missing")
 	//
 	flag.StringVar(&locaFilename, "filepath", "/dumps/oom", "maybe the path is 'dumps/oom'?")
 	flag.StringVar(&podId, "k", "ops", "PodId")
-	postfix = time.Now().Format("20060102150405")
+	flag.IntVar(&teamSegments, "team-segments", 1, "number of leading workload name segments that make up the team")
+	flag.BoolVar(&k8sAPI, "k8s-api", false, "read pod namespace, labels, owner, node, image, limits and restarts from the API server, needs get pods RBAC")
+	flag.StringVar(&namespace, "namespace", "", "pod namespace for -k8s-api, defaults to POD_NAMESPACE or the service account namespace")
+	flag.StringVar(&downwardAPIDir, "downward-api-dir", "", "downward API volume with labels, annotations, namespace, node_name files, used when -k8s-api is off or fails")
+	flag.StringVar(&container, "container", "", "container running the JVM, defaults to the first container")
+	flag.StringVar(&alertPodLabels, "alert-pod-labels", "", "comma separated pod labels added to alertmanager alerts as label_<name>")
+	flag.StringVar(&teams, "teams", "", "comma separated teams containing dashes, e.g. data-platform, matched before -team-segments")
 }
 
 // 判断所给路径文件是否存在
@@ -56,9 +233,355 @@ func PathExists(path string) (bool, error) {
 	return false, err
 }
 
-func main() {
-	flag.Parse()
-	remoteConfig := []prom.RemoteConfig{
+// 解析pod名，去掉ReplicaSet hash、序号等后缀
+func podParser() podname.Parser {
+	return podname.Parser{TeamSegments: teamSegments, Teams: splitList(teams)}
+}
+
+// 读取pod信息，没有开启或读取失败时返回nil，不影响上传
+func podMeta() *logic.PodMeta {
+	if k8sAPI {
+		c, err := k8s.InClusterClient()
+		if err == nil {
+			ns := namespace
+			if ns == "" {
+				ns = k8s.InClusterNamespace()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var pod *k8s.Pod
+			if pod, err = c.GetPod(ctx, ns, podId); err == nil {
+				return logic.NewPodMeta(pod, container, "api")
+			}
+		}
+		logger.Warningf("[pod_meta][api][pod:%s][err:%v]", podId, err)
+	}
+	if downwardAPIDir != "" {
+		pod, err := k8s.ReadDownwardAPI(downwardAPIDir)
+		if err != nil {
+			logger.Warningf("[pod_meta][downward][dir:%s][err:%v]", downwardAPIDir, err)
+			return nil
+		}
+		if pod.Metadata.Name == "" {
+			pod.Metadata.Name = podId
+		}
+		return logic.NewPodMeta(pod, container, "downward")
+	}
+	return nil
+}
+
+// 存储地址，未指定-target时沿用-cosurl
+func storageTarget() (string, error) {
+	if target != "" {
+		return target, nil
+	}
+	if cosUrl == "" {
+		return "", fmt.Errorf("-target or -cosurl is required")
+	}
+	u, err := url.Parse(cosUrl)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("cos://%s", u.Host), nil
+}
+
+// 对象存储凭证，依次查找: -secret/-secretkey(也可以来自配置文件、DUMP_HANDLER_SECRET等环境变量)、
+// -secret-file/-secretkey-file、-credentials-file、-secrets-dir、云厂商SDK的环境变量
+func credential() (storage.Credential, error) {
+	c, from, err := secrets.Resolve(
+		secrets.FromValues("flags", secretID, secretKey),
+		secrets.FromFiles(secretIDFile, secretKeyFile),
+		secrets.FromJSON(credentialsFile),
+		secrets.FromDir(secretsDir),
+		secrets.FromCloudEnv(),
+	)
+	if err != nil {
+		return storage.Credential{}, err
+	}
+	logger.Debugf("[credential][from:%s]", from)
+	return storage.Credential{SecretID: c.SecretID, SecretKey: c.SecretKey}, nil
+}
+
+// 本地目录不需要凭证，其他后端没有凭证时报错
+func backendFor(st string) (storage.Backend, error) {
+	if strings.HasPrefix(st, "file://") {
+		return storage.New(st, storage.Credential{})
+	}
+	cred, err := credential()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", st, err)
+	}
+	return storage.New(st, cred)
+}
+
+// 加密用的主密钥，未配置时返回nil，不加密
+func keyWrapper() (envelope.KeyWrapper, error) {
+	switch {
+	case keyFile != "" && kmsUrl != "":
+		return nil, fmt.Errorf("-encrypt-key-file and -kms-url are mutually exclusive")
+	case keyFile != "":
+		return envelope.LoadKeyFile(keyFile)
+	case kmsUrl != "":
+		return envelope.NewKMS(kmsUrl, kmsKeyID, kmsToken), nil
+	}
+	return nil, nil
+}
+
+func newBackend() (storage.Backend, error) {
+	st, err := storageTarget()
+	if err != nil {
+		return nil, err
+	}
+	return backendFor(st)
+}
+
+// 下载dump并按对象名后缀解密、解压: dump-handler download -object <key> -o <file>
+func download() error {
+	if objectKey == "" {
+		return fmt.Errorf("-object is required")
+	}
+	backend, err := newBackend()
+	if err != nil {
+		return err
+	}
+	kw, err := keyWrapper()
+	if err != nil {
+		return err
+	}
+	r, err := logic.OpenDump(context.Background(), backend, objectKey, kw)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	out := os.Stdout
+	if outputPath != "" {
+		if out, err = os.Create(outputPath); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// 监听目录，sidecar与业务容器共享emptyDir，每出现一个新dump上传一次: dump-handler watch -watch-dir /dumps
+func watchDumps() error {
+	dir, patterns := watchDir, splitList(watchPatterns)
+	if dir == "" {
+		dir = filepath.Dir(locaFilename)
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"*.hprof", filepath.Base(locaFilename)}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	w := watch.New(watch.Options{
+		Dir:          dir,
+		Patterns:     patterns,
+		PollInterval: watchInterval,
+		NoInotify:    !watchInotify,
+		After:        watchAfter,
+		MaxAttempts:  watchMaxAttempts,
+	})
+	logger.Infof("[watch][dir:%s][patterns:%v][inotify:%v]", dir, patterns, watchInotify)
+	handle := func(path string) error {
+		return handleDump(localDump(path))
+	}
+	if err := w.Run(ctx, handle); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// nodeDump 按路径中的pod UID找到pod，API server不可用或pod已删除时从kubelet生成的hosts文件取pod名
+func nodeDump(pods *k8s.NodePods, path string) dump {
+	d := dump{path: path, env: env}
+	uid, _ := k8s.PodUID(kubeletDir, path)
+	if pods != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		pod, err := pods.Get(ctx, uid)
+		if err != nil {
+			logger.Warningf("[node][pod_uid:%s][err:%v]", uid, err)
+		}
+		if pod != nil {
+			d.pod = pod.Metadata.Name
+			d.meta = logic.NewPodMeta(pod, container, "api")
+			for _, c := range pod.Spec.Containers {
+				if v := c.EnvValue(envVar); c.Name == d.meta.Container && v != "" {
+					d.env = v
+				}
+			}
+		}
+	}
+	if d.pod == "" {
+		d.pod = k8s.EtcHostsName(kubeletDir, uid)
+	}
+	if d.pod == "" {
+		d.pod = uid
+	}
+	return d
+}
+
+// 节点模式，DaemonSet挂载kubelet目录，收集节点上所有pod的emptyDir中的dump: dump-handler node -node-name $NODE_NAME
+func nodeDumps() error {
+	node := nodeName
+	if node == "" {
+		node = os.Getenv("NODE_NAME")
+	}
+	var pods *k8s.NodePods
+	c, err := k8s.InClusterClient()
+	switch {
+	case err != nil:
+		logger.Warningf("[node][err:%v], pod names fall back to etc-hosts", err)
+	case node == "":
+		logger.Warningf("[node] -node-name or NODE_NAME not set, pod names fall back to etc-hosts")
+	default:
+		// emptyDir在pod删除后才回收，pod从API server消失后继续缓存一段时间
+		pods = k8s.NewNodePods(c, node, time.Hour)
+	}
+	patterns := splitList(watchPatterns)
+	if len(patterns) == 0 {
+		patterns = []string{"*.hprof", filepath.Base(locaFilename)}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	w := watch.New(watch.Options{
+		Dir:          k8s.EmptyDirGlob(kubeletDir),
+		Patterns:     patterns,
+		PollInterval: watchInterval,
+		After:        watchAfter,
+		MaxAttempts:  watchMaxAttempts,
+	})
+	logger.Infof("[node][name:%s][kubelet_dir:%s][patterns:%v]", node, kubeletDir, patterns)
+	handle := func(path string) error {
+		return handleDump(nodeDump(pods, path))
+	}
+	if err := w.Run(ctx, handle); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// 删除已过保留期的dump
+func prune() error {
+	backend, err := newBackend()
+	if err != nil {
+		return err
+	}
+	n, err := logic.Prune(context.Background(), backend, prunePrefix, time.Now(), dryRun)
+	logger.Infof("[prune][target:%s][prefix:%s][expired:%d][dry_run:%v]", backend.URL(), prunePrefix, n, dryRun)
+	if !dryRun {
+		// 本机dump目录和spool中还有断点的上传可能随后续传，不能放弃
+		keep := storage.CheckpointUploadIDs(filepath.Join(filepath.Dir(locaFilename), "*.cp"))
+		if spoolDir != "" {
+			keep = append(keep, storage.CheckpointUploadIDs(filepath.Join(spoolDir, "*.cp"))...)
+		}
+		logic.AbortOrphanUploads(context.Background(), backend, prunePrefix, orphanAge, keep...)
+	}
+	return err
+}
+
+// dump-handler.io/bucket注解指定的桶替换到存储地址中，需要在-allowed-buckets中；
+// node、core模式处理节点上所有pod的dump，没有配置-allowed-buckets时不允许使用该注解
+func annotationTarget(st, bucket string) (string, error) {
+	t, err := logic.WithBucket(st, bucket)
+	if err != nil {
+		return "", err
+	}
+	allowed := splitList(allowedBuckets)
+	if len(allowed) == 0 {
+		if sharedNode {
+			return "", fmt.Errorf("-allowed-buckets is required in node and core mode")
+		}
+		return t, nil
+	}
+	name, err := logic.BucketName(t)
+	if err == nil {
+		for _, a := range allowed {
+			if a == name {
+				return t, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("bucket %s is not in -allowed-buckets", bucket)
+}
+
+// 逗号分隔的列表，忽略空项
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// 配置了的通知渠道
+func notifiers() ([]logic.Notifier, error) {
+	ts, err := logic.LoadTemplates(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	var ns []logic.Notifier
+	if dingWebhook != "" {
+		ns = append(ns, logic.DingTalkNotifier{Robot: dingtalk.NewRobot(dingWebhook, dingSecret, splitList(dingAt), false), Templates: ts})
+	}
+	if wecomWebhook != "" {
+		ns = append(ns, logic.WeComNotifier{Robot: wecom.NewRobot(wecomWebhook), Templates: ts})
+	}
+	if feishuWebhook != "" {
+		ns = append(ns, logic.FeishuNotifier{Robot: feishu.NewRobot(feishuWebhook, feishuSecret), Templates: ts})
+	}
+	if slackWebhook != "" {
+		ns = append(ns, logic.SlackNotifier{Webhook: slack.NewWebhook(slackWebhook), Templates: ts})
+	}
+	if alertmanagerUrl != "" {
+		ns = append(ns, logic.AlertmanagerNotifier{Client: alertmanager.NewClient(splitList(alertmanagerUrl)), EndsAfter: alertEndsAfter, Templates: ts})
+	}
+	if webhookUrl != "" {
+		ns = append(ns, logic.WebhookNotifier{Webhook: webhook.New(webhookUrl, fileConfig.Notify.Webhook.Headers)})
+	}
+	return ns, nil
+}
+
+// 路由表，默认路由使用-target(或-cosurl)和-key-template，通知渠道为命令行配置的渠道
+func routeTable() (*logic.RouteTable, []error) {
+	ts, err := logic.LoadTemplates(templateFile)
+	if err != nil {
+		return nil, []error{err}
+	}
+	def := &logic.Route{Name: "default", Target: target, KeyTemplate: keyTemplate}
+	if def.Target == "" && cosUrl != "" {
+		def.Target, _ = storageTarget()
+	}
+	return logic.NewRouteTable(fileConfig.Routes, def, fileConfig.Channels, ts)
+}
+
+// 未配置-prom时返回nil，不写入biz_oom_dump指标
+// 配置文件中有prom.remote_write时使用配置文件的，否则由-prom生成
+func promRemoteWrite() []prom.RemoteConfig {
+	if len(fileConfig.Prom.RemoteWrite) > 0 {
+		rcs := make([]prom.RemoteConfig, 0, len(fileConfig.Prom.RemoteWrite))
+		for _, rc := range fileConfig.Prom.RemoteWrite {
+			if rc.Ka == "" {
+				rc.Ka = ka
+			}
+			if rc.Env == "" {
+				rc.Env = env
+			}
+			if rc.RemoteTimeoutSecond <= 0 {
+				rc.RemoteTimeoutSecond = 5
+			}
+			rcs = append(rcs, rc)
+		}
+		return rcs
+	}
+	if promUrl == "" {
+		return nil
+	}
+	return []prom.RemoteConfig{
 		{
 			Name:                "prometheus",
 			Ka:                  ka,
@@ -67,32 +590,205 @@ func main() {
 			RemoteTimeoutSecond: 5,
 		},
 	}
+}
+
+func newPromDataSource() (*prom.DataSource, error) {
+	remoteConfig := promRemoteWrite()
+	if len(remoteConfig) == 0 {
+		return nil, nil
+	}
 	promConfig := prom.Section{RemoteWrite: remoteConfig}
 	pd := prom.NewPromDataSource(promConfig)
 	if err := pd.Init(); err != nil {
+		return nil, err
+	}
+	return pd, nil
+}
+
+// 上传失败时把dump保存到spool目录，之后通过drain子命令重新上传，返回是否保存成功
+func spoolUpload(st, key string, d dump, opt logic.UploadOptions) bool {
+	if spoolDir == "" {
+		return false
+	}
+	sp, err := spool.Open(spoolDir)
+	if err == nil {
+		err = logic.SpoolUploadJob(sp, st, key, d.path, opt, ka, d.env, d.pod, d.meta)
+	}
+	if err != nil {
+		logger.Errorf("spool upload failed![%v]\n", err)
+		return false
+	}
+	return true
+}
+
+// 告警没有发出时保存到spool目录
+func spoolAlarm(points ...prom.MetricPoint) {
+	if spoolDir == "" {
 		return
 	}
+	sp, err := spool.Open(spoolDir)
+	if err == nil {
+		err = logic.SpoolAlarmJob(sp, points)
+	}
+	if err != nil {
+		logger.Errorf("spool alarm failed![%v]\n", err)
+	}
+}
+
+// 重放spool目录中上传失败的dump和没有发出的告警: dump-handler drain -spool-dir <dir>
+func drain() error {
+	if spoolDir == "" {
+		return fmt.Errorf("-spool-dir is required")
+	}
+	sp, err := spool.Open(spoolDir)
+	if err != nil {
+		return err
+	}
+	kw, err := keyWrapper()
+	if err != nil {
+		return err
+	}
+	// 任务都在本地目录时可以没有凭证
+	cred, err := credential()
+	if err != nil && err != secrets.ErrNoCredential {
+		return err
+	}
+	opt := logic.DrainOptions{
+		Credential:   cred,
+		Encryption:   kw,
+		FlushTimeout: flushTimeout,
+		Finish:       drainFinish,
+	}
+	if opt.Prom, err = newPromDataSource(); err != nil {
+		logger.Warningf("prometheus not available, alarm jobs are kept![%v]\n", err)
+	} else if opt.Prom == nil {
+		opt.PromDisabled = true
+	}
+	res, err := logic.Drain(context.Background(), sp, opt)
+	if err != nil {
+		return err
+	}
+	logger.Infof("drain spool done![done:%d][failed:%d]\n", res.Done, res.Failed)
+	if res.Failed > 0 {
+		return fmt.Errorf("%d spooled jobs failed", res.Failed)
+	}
+	return nil
+}
+
+// 解析参数，配置有误时打印全部错误后退出
+func mustParseFlags(args []string) {
+	if errs := parseFlags(args); len(errs) > 0 {
+		for _, err := range errs {
+			logger.Errorf("config error![%v]\n", err)
+		}
+		os.Exit(2)
+	}
+	secrets.RedactLogs(strings.ToUpper(logLevel))
+	registerSecrets()
+}
+
+// 参数中的密钥不出现在日志中，webhook地址本身就是凭证(如slack、飞书的token在路径中)，整个隐藏
+func registerSecrets() {
+	secrets.Register(secretID, secretKey, kmsToken, dingSecret, feishuSecret)
+	secrets.Register(dingWebhook, wecomWebhook, feishuWebhook, slackWebhook, webhookUrl)
+	for _, v := range fileConfig.Notify.Webhook.Headers {
+		secrets.Register(v)
+	}
+	for _, c := range fileConfig.Channels {
+		secrets.Register(c.Secret, c.Webhook)
+		for _, v := range c.Headers {
+			secrets.Register(v)
+		}
+	}
+}
+
+func main() {
+	// 解析参数之前先输出全部日志，参数中的错误也能看到
+	secrets.RedactLogs("DEBUG")
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "validate" {
+		os.Exit(configValidate(os.Args[3:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "download" {
+		mustParseFlags(os.Args[2:])
+		if err := download(); err != nil {
+			logger.Errorf("download error![%v]\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		mustParseFlags(os.Args[2:])
+		if err := watchDumps(); err != nil {
+			logger.Errorf("watch error![%v]\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "node" {
+		sharedNode = true
+		mustParseFlags(os.Args[2:])
+		if err := nodeDumps(); err != nil {
+			logger.Errorf("node error![%v]\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "core" {
+		sharedNode = true
+		if os.Getenv(EnvPrefix+"CONFIG") == "" {
+			if ok, _ := PathExists(DefaultCoreConfig); ok {
+				os.Setenv(EnvPrefix+"CONFIG", DefaultCoreConfig)
+			}
+		}
+		mustParseFlags(os.Args[2:])
+		if err := core(flag.Args()); err != nil {
+			logger.Errorf("core error![%v]\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "threads" {
+		mustParseFlags(os.Args[2:])
+		if err := threads(); err != nil {
+			logger.Errorf("thread dump error![%v]\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "prune" {
+		mustParseFlags(os.Args[2:])
+		if err := prune(); err != nil {
+			logger.Errorf("prune error![%v]\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "drain" {
+		mustParseFlags(os.Args[2:])
+		if err := drain(); err != nil {
+			logger.Errorf("drain spool error![%v]\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	mustParseFlags(os.Args[1:])
+
+	// JVM要等OnOutOfMemoryError执行完才离开安全点，线程dump交给后台进程在本进程退出后抓取
+	if threadDumpPid > 0 {
+		if err := spawnThreadCapture(threadDumpPid); err != nil {
+			logger.Errorf("thread dump error![%v]\n", err)
+		}
+	}
 
 	// 判断dump文件是否存在
 	exist, err := PathExists(locaFilename)
 	if err != nil {
-		logger.Error("get dir error![%v]\n", err)
+		logger.Errorf("get dir error![%v]\n", err)
 		return
 	}
 	if exist {
-		fileName := fmt.Sprintf("%s/%s/jvm/%s-%s", ka, env, podId, postfix)
-		f, err := os.Open(locaFilename)
-		if err != nil {
-			logger.Error("open file error![%v]\n", err)
-			return
-		}
-		if err = cos.Upload(cosUrl, secretID, secretKey, fileName, f); err != nil {
-			logger.Error("upload file error![%v]\n", err)
-			return
-		}
-		if err := logic.AlarmToProm(pd, cosUrl, fileName, ka, env); err != nil {
-			logger.Error("send alarm to prom failed,[%v]\n", err)
-			return
+		if err := handleDump(localDump(locaFilename)); err != nil {
+			logger.Errorf("handle dump error![%v]\n", err)
 		}
 	}
 }
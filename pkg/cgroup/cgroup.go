@@ -0,0 +1,68 @@
+package cgroup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Info 从/proc/<pid>/cgroup解析出的容器信息，不在容器中时为空
+type Info struct {
+	PodUID      string // kubelet的pod UID
+	ContainerID string // 64位的容器id
+}
+
+var (
+	// cgroup v1: /kubepods/burstable/pod<uid>/<id>
+	// cgroup v2(systemd): /kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid用_分隔>.slice/cri-containerd-<id>.scope
+	podRE       = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+	containerRE = regexp.MustCompile(`([0-9a-f]{64})(?:\.scope)?$`)
+)
+
+// Parse 解析cgroup文件，每行 hierarchy-ID:controllers:path
+func Parse(r io.Reader) (Info, error) {
+	var info Info
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		path := parts[2]
+		if m := podRE.FindStringSubmatch(path); m != nil && info.PodUID == "" {
+			info.PodUID = strings.Replace(m[1], "_", "-", -1)
+		}
+		if m := containerRE.FindStringSubmatch(path); m != nil && info.ContainerID == "" {
+			info.ContainerID = m[1]
+		}
+	}
+	return info, sc.Err()
+}
+
+// ForPID 读取/proc/<pid>/cgroup
+func ForPID(pid int) (Info, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return Info{}, err
+	}
+	return Parse(bytes.NewReader(data))
+}
+
+// Environ 读取/proc/<pid>/environ，容器中的HOSTNAME一般就是pod名
+func Environ(pid int) (map[string]string, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		if i := bytes.IndexByte(kv, '='); i > 0 {
+			env[string(kv[:i])] = string(kv[i+1:])
+		}
+	}
+	return env, nil
+}
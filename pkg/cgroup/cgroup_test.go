@@ -0,0 +1,43 @@
+package cgroup
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const id = "3f8b5d1c0a9e7f6b5d4c3b2a1908f7e6d5c4b3a29180f7e6d5c4b3a291807f6e"
+	cases := []struct {
+		name, cgroup string
+		want         Info
+	}{
+		{"v1", "12:memory:/kubepods/burstable/pod1b2c3d4e-5f60-7182-93a4-b5c6d7e8f901/" + id + "\n11:cpu:/kubepods/burstable/pod1b2c3d4e-5f60-7182-93a4-b5c6d7e8f901/" + id + "\n",
+			Info{"1b2c3d4e-5f60-7182-93a4-b5c6d7e8f901", id}},
+		{"v2", "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1b2c3d4e_5f60_7182_93a4_b5c6d7e8f901.slice/cri-containerd-" + id + ".scope\n",
+			Info{"1b2c3d4e-5f60-7182-93a4-b5c6d7e8f901", id}},
+		{"docker", "0::/docker/" + id + "\n", Info{"", id}},
+		{"host", "0::/user.slice/user-1000.slice/session-1.scope\n", Info{}},
+	}
+	for _, c := range cases {
+		got, err := Parse(strings.NewReader(c.cgroup))
+		if err != nil || got != c.want {
+			t.Fatalf("%s: got %+v %v", c.name, got, err)
+		}
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("procfs is only available on linux")
+	}
+	// /proc/<pid>/environ是进程启动时的环境变量
+	env, err := Environ(os.Getpid())
+	if err != nil || len(env) != len(os.Environ()) {
+		t.Fatalf("got %d vars, want %d: %v", len(env), len(os.Environ()), err)
+	}
+	if _, err := ForPID(os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+}
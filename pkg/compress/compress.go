@@ -0,0 +1,119 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec 压缩算法
+type Codec string
+
+const (
+	None Codec = "none"
+	Gzip Codec = "gzip"
+	Zstd Codec = "zstd"
+)
+
+// Parse 解析命令行中的压缩算法，空字符串等同于none
+func Parse(name string) (Codec, error) {
+	switch c := Codec(strings.ToLower(strings.TrimSpace(name))); c {
+	case "", None:
+		return None, nil
+	case Gzip, Zstd:
+		return c, nil
+	default:
+		return None, fmt.Errorf("unsupported compress codec %q, available: none, gzip, zstd", name)
+	}
+}
+
+// Extension 压缩后对象名的后缀
+func (c Codec) Extension() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// ContentType 压缩后对象的Content-Type
+func (c Codec) ContentType() string {
+	switch c {
+	case Gzip:
+		return "application/gzip"
+	case Zstd:
+		return "application/zstd"
+	}
+	return "application/octet-stream"
+}
+
+// NewWriter 返回压缩写入器，level为0时使用默认级别；
+// gzip取值1-9，zstd取值1-22，会映射到klauspost/compress支持的4个档位
+func NewWriter(w io.Writer, c Codec, level int) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case Zstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	case None:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported compress codec %q", c)
+}
+
+// NewReader 返回解压读取器
+func NewReader(r io.Reader, c Codec) (io.ReadCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case None:
+		return io.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("unsupported compress codec %q", c)
+}
+
+// Reader 边读边压缩，压缩在单独的goroutine中进行，内存占用与文件大小无关
+func Reader(r io.Reader, c Codec, level int) io.ReadCloser {
+	if c == None {
+		return io.NopCloser(r)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := NewWriter(pw, c, level)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err = io.Copy(w, r); err != nil {
+			w.Close()
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,41 @@
+package compress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("JAVA PROFILE 1.0.2\x00 heap dump "), 10000)
+	for _, c := range []Codec{None, Gzip, Zstd} {
+		compressed, err := ioutil.ReadAll(Reader(bytes.NewReader(data), c, 0))
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+		if c != None && len(compressed) >= len(data)/5 {
+			t.Fatalf("%s: compressed size %d of %d", c, len(compressed), len(data))
+		}
+		r, err := NewReader(bytes.NewReader(compressed), c)
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: round trip mismatch, err=%v", c, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if c, err := Parse("ZSTD"); err != nil || c != Zstd || c.Extension() != ".zst" {
+		t.Fatalf("got %v %v", c, err)
+	}
+	if c, err := Parse(""); err != nil || c != None || c.Extension() != "" {
+		t.Fatalf("got %v %v", c, err)
+	}
+	if _, err := Parse("lz4"); err == nil {
+		t.Fatal("expected error for unsupported codec")
+	}
+}
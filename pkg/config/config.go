@@ -0,0 +1,251 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 配置文件按结构体的json tag组织，YAML先转换成和JSON一样的map再处理，两种格式写法相同。
+// 带flag tag的字段对应同名的命令行参数，优先级从低到高: 参数默认值 < 配置文件 < 环境变量 < 命令行。
+// 时长参数可以写成"10s"，也可以直接写数字，按秒处理
+
+// Load 读取YAML或JSON配置文件，.json按JSON解析，其他按YAML解析(YAML兼容JSON)
+func Load(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(data, strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Parse 解析配置内容，空内容返回空map
+func Parse(data []byte, isJSON bool) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return m, nil
+	}
+	if isJSON {
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return m, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("top level must be a mapping")
+	}
+	return m, nil
+}
+
+// normalize yaml.v2的map[interface{}]interface{}转换成map[string]interface{}
+func normalize(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key %v", k)
+			}
+			nv, err := normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			m[ks] = nv
+		}
+		return m, nil
+	case []interface{}:
+		for i := range t {
+			nv, err := normalize(t[i])
+			if err != nil {
+				return nil, err
+			}
+			t[i] = nv
+		}
+	}
+	return v, nil
+}
+
+// Decode 把map解析到结构体，用于没有对应命令行参数的配置项，如列表、map
+func Decode(m map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Explicit 命令行中指定了的参数
+func Explicit(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// ApplyFlags 按schema的flag tag把m中出现的配置项设置到命令行没有指定的参数上，
+// 一次返回所有错误，包括schema中不存在的配置项。时长参数写成数字的，在m中替换成"<数字>s"，之后Decode到字符串字段不会出错
+func ApplyFlags(fs *flag.FlagSet, schema interface{}, m map[string]interface{}, explicit map[string]bool) []error {
+	t := reflect.TypeOf(schema)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return applyFlags(fs, t, m, "", explicit)
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+func applyFlags(fs *flag.FlagSet, t reflect.Type, m map[string]interface{}, prefix string, explicit map[string]bool) []error {
+	var errs []error
+	known := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		known[name] = true
+		v, ok := m[name]
+		if !ok || v == nil {
+			continue
+		}
+		key := prefix + name
+		if flagName := f.Tag.Get("flag"); flagName != "" {
+			if d, ok := durationValue(fs, flagName, v); ok {
+				m[name], v = d, d
+			}
+			if explicit[flagName] {
+				continue
+			}
+			if err := fs.Set(flagName, flagValue(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", key, err))
+			}
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			sub, ok := v.(map[string]interface{})
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: must be a mapping", key))
+				continue
+			}
+			errs = append(errs, applyFlags(fs, ft, sub, key+".", explicit)...)
+		}
+	}
+	var unknown []string
+	for k := range m {
+		if !known[k] {
+			unknown = append(unknown, prefix+k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		errs = append(errs, fmt.Errorf("%s: unknown key", k))
+	}
+	return errs
+}
+
+// flagValue 配置值转换成命令行参数的字符串，列表用逗号连接
+func flagValue(v interface{}) string {
+	switch t := v.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(t))
+		for _, item := range t {
+			items = append(items, flagValue(item))
+		}
+		return strings.Join(items, ",")
+	case string:
+		return t
+	}
+	return fmt.Sprint(v)
+}
+
+// durationValue 时长参数的值是数字时按秒转换，如 3600 -> 3600s
+func durationValue(fs *flag.FlagSet, name string, v interface{}) (string, bool) {
+	f := fs.Lookup(name)
+	if f == nil {
+		return "", false
+	}
+	if g, ok := f.Value.(flag.Getter); !ok {
+		return "", false
+	} else if _, ok := g.Get().(time.Duration); !ok {
+		return "", false
+	}
+	var s string
+	switch t := v.(type) {
+	case json.Number:
+		s = t.String()
+	case int, int64, uint64, float64:
+		s = fmt.Sprint(t)
+	case string:
+		s = strings.TrimSpace(t)
+	default:
+		return "", false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return "", false
+	}
+	return s + "s", true
+}
+
+// EnvName 参数对应的环境变量，如 prefix=DUMP_HANDLER_，part-size -> DUMP_HANDLER_PART_SIZE
+func EnvName(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// ApplyEnv 用环境变量覆盖命令行没有指定的参数
+func ApplyEnv(fs *flag.FlagSet, prefix string, explicit map[string]bool) []error {
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+		env := EnvName(prefix, f.Name)
+		if v, ok := os.LookupEnv(env); ok {
+			if d, ok := durationValue(fs, f.Name, v); ok {
+				v = d
+			}
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", env, err))
+			}
+		}
+	})
+	return errs
+}
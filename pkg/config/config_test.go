@@ -0,0 +1,132 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schema struct {
+	Name    string `json:"name" flag:"name"`
+	Storage struct {
+		PartSize int64    `json:"part_size" flag:"part-size"`
+		Timeout  string   `json:"timeout" flag:"timeout"`
+		Validate bool     `json:"validate" flag:"validate"`
+		URLs     []string `json:"urls" flag:"urls"`
+	} `json:"storage"`
+	Headers map[string]string `json:"headers"`
+}
+
+func newFlagSet() (*flag.FlagSet, map[string]interface{}) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	v := map[string]interface{}{
+		"name":      fs.String("name", "default", ""),
+		"part-size": fs.Int64("part-size", 1, ""),
+		"timeout":   fs.Duration("timeout", time.Second, ""),
+		"validate":  fs.Bool("validate", true, ""),
+		"urls":      fs.String("urls", "", ""),
+	}
+	return fs, v
+}
+
+func TestPrecedence(t *testing.T) {
+	yamlText := `
+name: from-file
+storage:
+  part_size: 33554432
+  timeout: 1m
+  validate: false
+  urls: [http://a, http://b]
+headers:
+  Authorization: Bearer x
+`
+	jsonText := `{"name":"from-file","storage":{"part_size":33554432,"timeout":"1m","validate":false,"urls":["http://a","http://b"]},"headers":{"Authorization":"Bearer x"}}`
+	for _, c := range []struct {
+		text   string
+		isJSON bool
+	}{{yamlText, false}, {jsonText, true}} {
+		m, err := Parse([]byte(c.text), c.isJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs, v := newFlagSet()
+		fs.Parse([]string{"-name", "from-flag"})
+		explicit := Explicit(fs)
+		os.Setenv("T_TIMEOUT", "2m")
+		os.Setenv("T_NAME", "from-env")
+		defer os.Unsetenv("T_TIMEOUT")
+		defer os.Unsetenv("T_NAME")
+		if errs := ApplyFlags(fs, &schema{}, m, explicit); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if errs := ApplyEnv(fs, "T_", explicit); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if *v["name"].(*string) != "from-flag" || *v["part-size"].(*int64) != 32<<20 ||
+			*v["timeout"].(*time.Duration) != 2*time.Minute || *v["validate"].(*bool) ||
+			*v["urls"].(*string) != "http://a,http://b" {
+			t.Fatalf("json=%v: unexpected values name=%s part=%d timeout=%v validate=%v urls=%s", c.isJSON,
+				*v["name"].(*string), *v["part-size"].(*int64), *v["timeout"].(*time.Duration), *v["validate"].(*bool), *v["urls"].(*string))
+		}
+		var cfg schema
+		if err := Decode(m, &cfg); err != nil || cfg.Headers["Authorization"] != "Bearer x" {
+			t.Fatalf("decode: %+v %v", cfg, err)
+		}
+	}
+}
+
+func TestAllErrors(t *testing.T) {
+	m, err := Parse([]byte("name: x\nstorage:\n  part_size: big\n  timeout: soon\n  nope: 1\nextra: true\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, _ := newFlagSet()
+	errs := ApplyFlags(fs, &schema{}, m, nil)
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	joined := strings.Join(msgs, "\n")
+	for _, want := range []string{"storage.part_size", "storage.timeout", "storage.nope: unknown key", "extra: unknown key"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in:\n%s", want, joined)
+		}
+	}
+}
+
+func TestDurationSeconds(t *testing.T) {
+	for _, c := range []struct {
+		text   string
+		isJSON bool
+		want   time.Duration
+	}{
+		{"storage:\n  timeout: 90\n", false, 90 * time.Second},
+		{`{"storage":{"timeout":1.5}}`, true, 1500 * time.Millisecond},
+		{`{"storage":{"timeout":"2m"}}`, true, 2 * time.Minute},
+	} {
+		m, err := Parse([]byte(c.text), c.isJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs, v := newFlagSet()
+		if errs := ApplyFlags(fs, &schema{}, m, nil); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if got := *v["timeout"].(*time.Duration); got != c.want {
+			t.Fatalf("%s: got %v, want %v", c.text, got, c.want)
+		}
+		var cfg schema
+		if err := Decode(m, &cfg); err != nil {
+			t.Fatalf("%s: decode: %v", c.text, err)
+		}
+	}
+
+	fs, v := newFlagSet()
+	os.Setenv("T_TIMEOUT", "30")
+	defer os.Unsetenv("T_TIMEOUT")
+	if errs := ApplyEnv(fs, "T_", nil); len(errs) > 0 || *v["timeout"].(*time.Duration) != 30*time.Second {
+		t.Fatalf("env: %v %v", errs, *v["timeout"].(*time.Duration))
+	}
+}
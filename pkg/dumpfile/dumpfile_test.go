@@ -0,0 +1,115 @@
+package dumpfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func record(tag byte, body []byte) []byte {
+	var hdr [recordHeaderSize]byte
+	hdr[0] = tag
+	binary.BigEndian.PutUint32(hdr[5:], uint32(len(body)))
+	return append(hdr[:], body...)
+}
+
+func fakeHprof() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("JAVA PROFILE 1.0.2\x00")
+	buf.Write([]byte{0, 0, 0, 8})
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], 1622548800123)
+	buf.Write(ts[:])
+	buf.Write(record(0x01, []byte("\x00\x00\x00\x00\x00\x00\x00\x01java/lang/String")))
+	buf.Write(record(tagHeapDumpSeg, make([]byte, 2*seekThreshold)))
+	buf.Write(record(tagHeapDumpSeg, make([]byte, 100)))
+	buf.Write(record(tagHeapDumpEnd, nil))
+	return buf.Bytes()
+}
+
+func TestValidateHprof(t *testing.T) {
+	dir := t.TempDir()
+	data := fakeHprof()
+	good := filepath.Join(dir, "good")
+	ioutil.WriteFile(good, data, 0644)
+	if err := ValidateHprof(good); err != nil {
+		t.Fatal(err)
+	}
+	// 截断在HEAP DUMP SEGMENT中间
+	cut := filepath.Join(dir, "cut")
+	ioutil.WriteFile(cut, data[:len(data)-200], 0644)
+	if err := ValidateHprof(cut); err == nil {
+		t.Fatal("expected error for truncated record")
+	}
+	// 记录完整但缺少HEAP DUMP END
+	noEnd := filepath.Join(dir, "noend")
+	ioutil.WriteFile(noEnd, data[:len(data)-recordHeaderSize], 0644)
+	if err := ValidateHprof(noEnd); err == nil {
+		t.Fatal("expected error for missing HEAP DUMP END")
+	}
+	other := filepath.Join(dir, "core")
+	ioutil.WriteFile(other, []byte("\x7fELF"), 0644)
+	if ok, _ := IsHprof(other); ok {
+		t.Fatal("ELF file is not hprof")
+	}
+
+	h, err := ReadHprofHeader(good)
+	if err != nil || h == nil || h.Version != "JAVA PROFILE 1.0.2" || h.IDSize != 8 || h.Time.UnixNano() != 1622548800123*int64(time.Millisecond) {
+		t.Fatalf("hprof header: %+v %v", h, err)
+	}
+	if h, err := ReadHprofHeader(other); h != nil || err != nil {
+		t.Fatalf("ELF file header: %+v %v", h, err)
+	}
+}
+
+func TestWaitStable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oom")
+	data := fakeHprof()
+	ioutil.WriteFile(path, data[:100], 0644)
+	go func() {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		defer f.Close()
+		for i := 100; i < len(data); i += len(data) / 4 {
+			time.Sleep(30 * time.Millisecond)
+			end := i + len(data)/4
+			if end > len(data) {
+				end = len(data)
+			}
+			f.Write(data[i:end])
+		}
+	}()
+	opt := StableOptions{Interval: 20 * time.Millisecond, Checks: 5, Timeout: 5 * time.Second, Validate: true}
+	fi, err := WaitStable(context.Background(), path, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(data)) {
+		t.Fatalf("returned before writer finished: %d of %d", fi.Size(), len(data))
+	}
+}
+
+func TestWaitStableTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oom")
+	ioutil.WriteFile(path, []byte("x"), 0644)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				ioutil.WriteFile(path, bytes.Repeat([]byte("x"), i+2), 0644)
+			}
+		}
+	}()
+	opt := StableOptions{Interval: 10 * time.Millisecond, Checks: 3, Timeout: 100 * time.Millisecond}
+	if _, err := WaitStable(context.Background(), path, opt); err == nil {
+		t.Fatal("expected timeout")
+	}
+}
@@ -0,0 +1,145 @@
+package dumpfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// hprof格式:
+//
+//	"JAVA PROFILE 1.0.x\0" | id大小(u4) | 时间戳(u8) | 记录...
+//	记录: tag(u1) | 相对时间(u4) | 长度(u4) | 内容
+//
+// 分段的堆快照以HEAP DUMP SEGMENT(0x1C)记录组成，最后是HEAP DUMP END(0x2C)
+const (
+	hprofPrefix       = "JAVA PROFILE 1.0."
+	tagHeapDumpSeg    = 0x1C
+	tagHeapDumpEnd    = 0x2C
+	recordHeaderSize  = 9
+	seekThreshold     = 1 << 20
+	maxHprofHeaderLen = 64
+)
+
+// IsHprof 文件是否以hprof文件头开始
+func IsHprof(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, len(hprofPrefix))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false, nil
+	}
+	return string(buf) == hprofPrefix, nil
+}
+
+// HprofHeader hprof文件头
+type HprofHeader struct {
+	Version string    // 如 "JAVA PROFILE 1.0.2"
+	IDSize  int       // 对象id的字节数，64位JVM为8(压缩指针时也是8)
+	Time    time.Time // JVM开始写dump的时间
+}
+
+// ReadHprofHeader 读取hprof文件头，不是hprof文件时返回nil
+func ReadHprofHeader(path string) (*HprofHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, maxHprofHeaderLen+4+8)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	end := bytes.IndexByte(head, 0)
+	if !bytes.HasPrefix(head, []byte(hprofPrefix)) || end < 0 || end+1+4+8 > len(head) {
+		return nil, nil
+	}
+	ms := int64(binary.BigEndian.Uint64(head[end+5:]))
+	return &HprofHeader{
+		Version: string(head[:end]),
+		IDSize:  int(binary.BigEndian.Uint32(head[end+1:])),
+		Time:    time.Unix(ms/1000, ms%1000*int64(time.Millisecond)),
+	}, nil
+}
+
+// ValidateHprof 逐条跳过记录，检查最后一条记录正好结束在文件末尾；
+// 有HEAP DUMP SEGMENT时最后一条记录必须是HEAP DUMP END
+func ValidateHprof(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	br := bufio.NewReader(f)
+	head, err := br.Peek(maxHprofHeaderLen)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	end := bytes.IndexByte(head, 0)
+	if !bytes.HasPrefix(head, []byte(hprofPrefix)) || end < 0 {
+		return fmt.Errorf("%s: bad hprof header", path)
+	}
+	// 文件头 + id大小 + 时间戳
+	offset := int64(end + 1 + 4 + 8)
+	if offset > size {
+		return fmt.Errorf("%s: truncated hprof header", path)
+	}
+	if _, err := br.Discard(int(offset)); err != nil {
+		return fmt.Errorf("%s: truncated hprof header", path)
+	}
+
+	var (
+		hdr        [recordHeaderSize]byte
+		lastTag    byte
+		hasSegment bool
+		records    int
+	)
+	for offset < size {
+		if offset+recordHeaderSize > size {
+			return fmt.Errorf("%s: truncated record header at offset %d", path, offset)
+		}
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			return fmt.Errorf("%s: read record at offset %d: %v", path, offset, err)
+		}
+		tag := hdr[0]
+		length := int64(binary.BigEndian.Uint32(hdr[5:]))
+		offset += recordHeaderSize
+		if offset+length > size {
+			return fmt.Errorf("%s: record 0x%02X at offset %d needs %d bytes, only %d left",
+				path, tag, offset-recordHeaderSize, length, size-offset)
+		}
+		if length > seekThreshold {
+			// 大的记录直接seek，避免读整个堆快照
+			if _, err := f.Seek(offset+length, io.SeekStart); err != nil {
+				return err
+			}
+			br.Reset(f)
+		} else if _, err := br.Discard(int(length)); err != nil {
+			return fmt.Errorf("%s: read record at offset %d: %v", path, offset, err)
+		}
+		offset += length
+		lastTag = tag
+		hasSegment = hasSegment || tag == tagHeapDumpSeg
+		records++
+	}
+	if hasSegment && lastTag != tagHeapDumpEnd {
+		return fmt.Errorf("%s: heap dump segments not terminated by HEAP DUMP END (last tag 0x%02X, %d records)",
+			path, lastTag, records)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package dumpfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// StableOptions 判断dump文件写完的参数
+type StableOptions struct {
+	Interval time.Duration // 两次检查的间隔
+	Checks   int           // 连续多少次大小和mtime不变才认为写完
+	Timeout  time.Duration // 超过该时长仍在变化则放弃
+	Validate bool          // 是hprof文件时校验文件头和记录是否完整
+}
+
+// DefaultStableOptions 默认每秒检查一次，连续3次不变，最多等10分钟
+var DefaultStableOptions = StableOptions{
+	Interval: time.Second,
+	Checks:   3,
+	Timeout:  10 * time.Minute,
+	Validate: true,
+}
+
+// WaitStable 等待文件大小和mtime不再变化，Validate为true时再校验hprof是否完整，
+// 用于sidecar、cron等不是由-XX:OnOutOfMemoryError拉起的场景，避免上传写了一半的dump
+func WaitStable(ctx context.Context, path string, opt StableOptions) (os.FileInfo, error) {
+	if opt.Interval <= 0 {
+		opt.Interval = DefaultStableOptions.Interval
+	}
+	if opt.Checks <= 0 {
+		opt.Checks = DefaultStableOptions.Checks
+	}
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+
+	last, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	same := 0
+	ticker := time.NewTicker(opt.Interval)
+	defer ticker.Stop()
+	for same < opt.Checks {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s still changing after %v (size %d): %v", path, opt.Timeout, last.Size(), ctx.Err())
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() == last.Size() && fi.ModTime().Equal(last.ModTime()) {
+			same++
+		} else {
+			logger.Debugf("[wait_stable][path:%s][size:%d]", path, fi.Size())
+			same = 0
+		}
+		last = fi
+	}
+
+	if opt.Validate {
+		isHprof, err := IsHprof(path)
+		if err != nil {
+			return nil, err
+		}
+		if isHprof {
+			if err := ValidateHprof(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,253 @@
+package envelope
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 加密后的格式:
+//
+//	magic(4) | keyID长度(2) | keyID | 包裹后的数据密钥长度(2) | 包裹后的数据密钥 | nonce前缀(8) | 分段...
+//
+// 数据按64KB分段做AES-256-GCM，每段的nonce为 nonce前缀 + 4字节段序号，
+// 最后一段的附加数据为1，其余为0，截断或调换分段都会解密失败
+const (
+	Algorithm   = "aes-256-gcm"
+	Extension   = ".enc"
+	magic       = "DHE1"
+	segmentSize = 64 * 1024
+	keySize     = 32
+	prefixSize  = 8
+)
+
+var (
+	ErrBadHeader = errors.New("envelope: not an encrypted dump")
+	ErrTruncated = errors.New("envelope: ciphertext truncated or tampered")
+)
+
+// KeyWrapper 用主密钥包裹、解包数据密钥
+type KeyWrapper interface {
+	Wrap(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error)
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+func segmentNonce(prefix []byte, seq uint32) []byte {
+	nonce := make([]byte, prefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], seq)
+	return nonce
+}
+
+func aad(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func writeField(w io.Writer, b []byte) error {
+	if len(b) > 0xffff {
+		return fmt.Errorf("envelope: header field too long: %d", len(b))
+	}
+	var l [2]byte
+	binary.BigEndian.PutUint16(l[:], uint16(len(b)))
+	if _, err := w.Write(l[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func readField(r io.Reader) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, ErrBadHeader
+	}
+	b := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrBadHeader
+	}
+	return b, nil
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	seq    uint32
+	buf    []byte
+	closed bool
+}
+
+// NewWriter 生成随机数据密钥并用kw包裹后写入头部，之后写入的内容分段加密，Close时写出最后一段
+func NewWriter(ctx context.Context, w io.Writer, kw KeyWrapper) (io.WriteCloser, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := kw.Wrap(ctx, dek)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: wrap data key: %v", err)
+	}
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, magic); err != nil {
+		return nil, err
+	}
+	if err := writeField(w, []byte(keyID)); err != nil {
+		return nil, err
+	}
+	if err := writeField(w, wrapped); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, segmentSize)}, nil
+}
+
+func (ew *writer) seal(final bool) error {
+	out := ew.aead.Seal(nil, segmentNonce(ew.prefix, ew.seq), ew.buf, aad(final))
+	ew.seq++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(out)
+	return err
+}
+
+func (ew *writer) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("envelope: write after close")
+	}
+	n := 0
+	for len(p) > 0 {
+		// 缓冲区满且还有后续数据时才封一段，保证Close时最后一段非满或为空
+		if len(ew.buf) == segmentSize {
+			if err := ew.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(ew.buf[len(ew.buf):segmentSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (ew *writer) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.seal(true)
+}
+
+type reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	seq    uint32
+	plain  []byte
+	done   bool
+}
+
+// NewReader 读取头部并通过kw解包数据密钥，返回解密后的流
+func NewReader(ctx context.Context, r io.Reader, kw KeyWrapper) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, segmentSize+64)
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, m); err != nil || string(m) != magic {
+		return nil, ErrBadHeader
+	}
+	keyID, err := readField(br)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := readField(br)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, ErrBadHeader
+	}
+	dek, err := kw.Unwrap(ctx, string(keyID), wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: unwrap data key %s: %v", keyID, err)
+	}
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{r: br, aead: aead, prefix: prefix}, nil
+}
+
+func (er *reader) Read(p []byte) (int, error) {
+	for len(er.plain) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		seg := make([]byte, segmentSize+er.aead.Overhead())
+		n, err := io.ReadFull(er.r, seg)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				return 0, ErrTruncated
+			}
+			return 0, err
+		}
+		final := err == io.ErrUnexpectedEOF
+		if !final {
+			if _, perr := er.r.Peek(1); perr == io.EOF {
+				final = true
+			}
+		}
+		plain, oerr := er.aead.Open(nil, segmentNonce(er.prefix, er.seq), seg[:n], aad(final))
+		if oerr != nil {
+			return 0, ErrTruncated
+		}
+		er.seq++
+		er.plain = plain
+		er.done = final
+	}
+	n := copy(p, er.plain)
+	er.plain = er.plain[n:]
+	return n, nil
+}
+
+// Reader 边读边加密，加密在单独的goroutine中进行
+func Reader(ctx context.Context, r io.Reader, kw KeyWrapper) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := NewWriter(ctx, pw, kw)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err = io.Copy(w, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
@@ -0,0 +1,122 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func encrypt(t *testing.T, kw KeyWrapper, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(context.Background(), &buf, kw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(kw KeyWrapper, data []byte) ([]byte, error) {
+	r, err := NewReader(context.Background(), bytes.NewReader(data), kw)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestLocalKeyRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))+"\n"), 0600)
+	kw, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, segmentSize, segmentSize + 1, 3*segmentSize + 17} {
+		data := bytes.Repeat([]byte("password=hunter2 "), size/17+1)[:size]
+		enc := encrypt(t, kw, data)
+		if size > 0 && bytes.Contains(enc, []byte("hunter2")) {
+			t.Fatalf("size %d: plaintext leaked", size)
+		}
+		got, err := decrypt(kw, enc)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("size %d: round trip failed, err=%v", size, err)
+		}
+	}
+}
+
+func TestTruncatedOrTampered(t *testing.T) {
+	kw, _ := NewLocalKey(bytes.Repeat([]byte{1}, 32))
+	enc := encrypt(t, kw, bytes.Repeat([]byte("x"), 2*segmentSize+5))
+	// 在分段边界截断：去掉最后一段
+	trunc := enc[:len(enc)-(5+16)]
+	if _, err := decrypt(kw, trunc); err != ErrTruncated {
+		t.Fatalf("truncated: expected ErrTruncated, got %v", err)
+	}
+	tampered := append([]byte(nil), enc...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := decrypt(kw, tampered); err != ErrTruncated {
+		t.Fatalf("tampered: expected ErrTruncated, got %v", err)
+	}
+	other, _ := NewLocalKey(bytes.Repeat([]byte{2}, 32))
+	if _, err := decrypt(other, enc); err == nil {
+		t.Fatal("expected error with wrong master key")
+	}
+}
+
+// kmsStub 本地的KMS替身，用固定的主密钥包裹数据密钥
+func kmsStub(t *testing.T) *httptest.Server {
+	master, _ := NewLocalKey(bytes.Repeat([]byte{9}, 32))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var in kmsRequest
+		json.NewDecoder(r.Body).Decode(&in)
+		switch r.URL.Path {
+		case "/encrypt":
+			dek, _ := base64.StdEncoding.DecodeString(in.Plaintext)
+			_, wrapped, _ := master.Wrap(r.Context(), dek)
+			json.NewEncoder(w).Encode(kmsResponse{KeyID: in.KeyID, Ciphertext: base64.StdEncoding.EncodeToString(wrapped)})
+		case "/decrypt":
+			ct, _ := base64.StdEncoding.DecodeString(in.Ciphertext)
+			dek, err := master.Unwrap(r.Context(), master.id, ct)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(kmsResponse{Plaintext: base64.StdEncoding.EncodeToString(dek)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestKMSRoundTrip(t *testing.T) {
+	srv := kmsStub(t)
+	defer srv.Close()
+	kw := NewKMS(srv.URL, "dump-key", "s3cret")
+	data := bytes.Repeat([]byte("heap"), 50000)
+	enc, err := ioutil.ReadAll(Reader(context.Background(), bytes.NewReader(data), kw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decrypt(kw, enc)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("round trip failed, err=%v", err)
+	}
+	if _, err := decrypt(NewKMS(srv.URL, "dump-key", "wrong"), enc); err == nil {
+		t.Fatal("expected unauthorized error")
+	}
+}
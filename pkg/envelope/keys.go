@@ -0,0 +1,186 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LocalKey 本地keyfile中的主密钥
+type LocalKey struct {
+	id  string
+	key []byte
+}
+
+// LoadKeyFile 读取32字节的主密钥，文件内容可以是原始字节、hex或base64
+func LoadKeyFile(path string) (*LocalKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %v", path, err)
+	}
+	return NewLocalKey(key)
+}
+
+func decodeKey(data []byte) ([]byte, error) {
+	if len(data) == keySize {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if b, err := hex.DecodeString(text); err == nil && len(b) == keySize {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(text); err == nil && len(b) == keySize {
+		return b, nil
+	}
+	return nil, fmt.Errorf("master key must be %d bytes (raw, hex or base64)", keySize)
+}
+
+// NewLocalKey keyID取主密钥sha256的前8字节，轮换主密钥后能从头部看出用的是哪一把
+func NewLocalKey(key []byte) (*LocalKey, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", keySize, len(key))
+	}
+	sum := sha256.Sum256(key)
+	return &LocalKey{id: "local:" + hex.EncodeToString(sum[:8]), key: key}, nil
+}
+
+func (k *LocalKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (k *LocalKey) Wrap(_ context.Context, dek []byte) (string, []byte, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.id, aead.Seal(nonce, nonce, dek, []byte(k.id)), nil
+}
+
+func (k *LocalKey) Unwrap(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != k.id {
+		return nil, fmt.Errorf("data key wrapped by %s, but local master key is %s", keyID, k.id)
+	}
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrBadHeader
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+// KMS 通过HTTP接口包裹数据密钥，接口约定:
+//
+//	POST <url>/encrypt {"key_id":"...","plaintext":"<base64>"} -> {"key_id":"...","ciphertext":"<base64>"}
+//	POST <url>/decrypt {"key_id":"...","ciphertext":"<base64>"} -> {"plaintext":"<base64>"}
+type KMS struct {
+	url    string
+	keyID  string
+	token  string
+	client *http.Client
+}
+
+// NewKMS token不为空时以Bearer方式放在Authorization头里
+func NewKMS(url, keyID, token string) *KMS {
+	return &KMS{
+		url:    strings.TrimSuffix(url, "/"),
+		keyID:  keyID,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type kmsRequest struct {
+	KeyID      string `json:"key_id"`
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
+
+type kmsResponse struct {
+	KeyID      string `json:"key_id"`
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+func (k *KMS) call(ctx context.Context, op string, in kmsRequest) (*kmsResponse, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, k.url+"/"+op, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("kms %s returned HTTP status %s: %s", op, resp.Status, bytes.TrimSpace(msg))
+	}
+	out := &kmsResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("kms %s: decode response: %v", op, err)
+	}
+	return out, nil
+}
+
+func (k *KMS) Wrap(ctx context.Context, dek []byte) (string, []byte, error) {
+	out, err := k.call(ctx, "encrypt", kmsRequest{KeyID: k.keyID, Plaintext: base64.StdEncoding.EncodeToString(dek)})
+	if err != nil {
+		return "", nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(out.Ciphertext)
+	if err != nil {
+		return "", nil, fmt.Errorf("kms encrypt: bad ciphertext: %v", err)
+	}
+	keyID := out.KeyID
+	if keyID == "" {
+		keyID = k.keyID
+	}
+	return keyID, wrapped, nil
+}
+
+func (k *KMS) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	out, err := k.call(ctx, "decrypt", kmsRequest{KeyID: keyID, Ciphertext: base64.StdEncoding.EncodeToString(wrapped)})
+	if err != nil {
+		return nil, err
+	}
+	dek, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt: bad plaintext: %v", err)
+	}
+	return dek, nil
+}
@@ -0,0 +1,136 @@
+package podname
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Kind 根据pod名推断出的工作负载类型
+type Kind string
+
+const (
+	Deployment  Kind = "Deployment"  // <deployment>-<pod-template-hash>-<5位后缀>
+	StatefulSet Kind = "StatefulSet" // <statefulset>-<序号>
+	CronJob     Kind = "CronJob"     // <cronjob>-<调度时间(分钟)>-<5位后缀>
+	Job         Kind = "Job"         // <job>-<5位后缀>，DaemonSet的pod名也是这种形式
+	Pod         Kind = "Pod"         // 无法识别，直接创建的pod
+)
+
+// k8s生成名字后缀时使用的字符集(rand.SafeEncodeString)，去掉了元音和容易混淆的字符
+const safeChars = "bcdfghjklmnpqrstvwxz2456789"
+
+// Info pod名解析的结果
+type Info struct {
+	Pod      string `json:"pod"`
+	Workload string `json:"workload"` // 去掉ReplicaSet hash、pod后缀、序号后的工作负载名
+	Kind     Kind   `json:"kind"`
+	Ordinal  int    `json:"ordinal"` // StatefulSet的序号，其他类型为-1
+	Team     string `json:"team"`
+	App      string `json:"app"`
+}
+
+// Parser 解析pod名，工作负载名的前TeamSegments段为项目组，其余为app名；
+// 项目组本身带"-"时可以在Teams中列出，按最长前缀匹配
+type Parser struct {
+	TeamSegments int      // 默认1
+	Teams        []string // 已知的项目组，如 "data-platform"
+}
+
+func isSafe(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune(safeChars, c) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isOrdinal StatefulSet的序号：没有前导0的数字；5位且全是safeChars的数字也可能是随机后缀(如24579)，
+// 这种情况按随机后缀处理
+func isOrdinal(s string) bool {
+	if !isDigits(s) || len(s) > 5 || (len(s) > 1 && s[0] == '0') {
+		return false
+	}
+	return len(s) < 5 || !isSafe(s)
+}
+
+// workload 去掉控制器生成的后缀，先看前一段是不是pod-template-hash、CronJob的调度时间，再看序号
+func workload(segs []string) (string, Kind, int) {
+	n := len(segs)
+	suffix := n >= 2 && len(segs[n-1]) == 5 && isSafe(segs[n-1])
+	if suffix && n >= 3 {
+		prev := segs[n-2]
+		// CronJob创建的Job名以调度时间(自1970年起的分钟数)结尾
+		if isDigits(prev) && len(prev) >= 8 {
+			return strings.Join(segs[:n-2], "-"), CronJob, -1
+		}
+		// pod-template-hash一般为6到10位
+		if len(prev) >= 6 && len(prev) <= 10 && isSafe(prev) {
+			return strings.Join(segs[:n-2], "-"), Deployment, -1
+		}
+	}
+	if n >= 2 && isOrdinal(segs[n-1]) {
+		ord, _ := strconv.Atoi(segs[n-1])
+		return strings.Join(segs[:n-1], "-"), StatefulSet, ord
+	}
+	if suffix {
+		return strings.Join(segs[:n-1], "-"), Job, -1
+	}
+	return strings.Join(segs, "-"), Pod, -1
+}
+
+// Parse 解析pod名，如 "ops-demo-7d9f8c6b5-x2kzq" -> Deployment ops-demo，team ops，app demo
+func (p Parser) Parse(pod string) Info {
+	info := Info{Pod: pod}
+	info.Workload, info.Kind, info.Ordinal = workload(strings.Split(pod, "-"))
+	return p.split(info)
+}
+
+// WithWorkload 用API server等确切来源的工作负载覆盖从pod名推断的结果，重新划分项目组和app
+func (p Parser) WithWorkload(info Info, workload string, kind Kind) Info {
+	info.Workload, info.Kind = workload, kind
+	if kind != StatefulSet {
+		info.Ordinal = -1
+	}
+	return p.split(info)
+}
+
+// split 从工作负载名划分项目组和app
+func (p Parser) split(info Info) Info {
+	info.Team, info.App = "", ""
+	for _, t := range p.Teams {
+		if strings.HasPrefix(info.Workload, t+"-") && len(t) > len(info.Team) {
+			info.Team = t
+		}
+	}
+	if info.Team == "" {
+		n := p.TeamSegments
+		if n <= 0 {
+			n = 1
+		}
+		ws := strings.Split(info.Workload, "-")
+		if n >= len(ws) {
+			n = len(ws) - 1
+		}
+		if n <= 0 {
+			// 只有一段时项目组和app相同
+			info.Team, info.App = info.Workload, info.Workload
+			return info
+		}
+		info.Team = strings.Join(ws[:n], "-")
+	}
+	info.App = strings.TrimPrefix(info.Workload, info.Team+"-")
+	return info
+}
@@ -0,0 +1,49 @@
+package podname
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	p := Parser{Teams: []string{"data-platform"}}
+	cases := []struct {
+		pod      string
+		workload string
+		kind     Kind
+		ordinal  int
+		team     string
+		app      string
+	}{
+		{"ops-demo-7d9f8c6b5-x2kzq", "ops-demo", Deployment, -1, "ops", "demo"},
+		{"ops-order-api-5c8d7bfb9f-4wz2p", "ops-order-api", Deployment, -1, "ops", "order-api"},
+		{"pay-ledger-2", "pay-ledger", StatefulSet, 2, "pay", "ledger"},
+		{"pay-ledger-10", "pay-ledger", StatefulSet, 10, "pay", "ledger"},
+		{"pay-ledger-13579", "pay-ledger", StatefulSet, 13579, "pay", "ledger"},
+		// 全是数字的随机后缀
+		{"ops-demo-7d9f8c6b5-24579", "ops-demo", Deployment, -1, "ops", "demo"},
+		{"ops-migrate-24579", "ops-migrate", Job, -1, "ops", "migrate"},
+		// 有前导0的不是序号
+		{"ops-demo-007", "ops-demo-007", Pod, -1, "ops", "demo-007"},
+		{"ops-report-27063540-b7x9q", "ops-report", CronJob, -1, "ops", "report"},
+		{"ops-migrate-k8s2v", "ops-migrate", Job, -1, "ops", "migrate"},
+		{"data-platform-flink-tm-6b9f7c5d4-9xk2l", "data-platform-flink-tm", Deployment, -1, "data-platform", "flink-tm"},
+		// 单词中有元音，不会被当成hash
+		{"ops-gateway-server", "ops-gateway-server", Pod, -1, "ops", "gateway-server"},
+		{"standalone", "standalone", Pod, -1, "standalone", "standalone"},
+	}
+	for _, c := range cases {
+		got := p.Parse(c.pod)
+		if got.Workload != c.workload || got.Kind != c.kind || got.Ordinal != c.ordinal || got.Team != c.team || got.App != c.app {
+			t.Fatalf("%s: got %+v", c.pod, got)
+		}
+	}
+
+	two := Parser{TeamSegments: 2}
+	if got := two.Parse("bu-ops-demo-7d9f8c6b5-x2kzq"); got.Team != "bu-ops" || got.App != "demo" {
+		t.Fatalf("team segments: %+v", got)
+	}
+
+	// 名字不符合规则的Deployment，以ownerReferences为准
+	got := p.WithWorkload(p.Parse("ops-demo-0"), "ops-demo-canary", Deployment)
+	if got.Ordinal != -1 || got.App != "demo-canary" || got.Kind != Deployment {
+		t.Fatalf("with workload: %+v", got)
+	}
+}
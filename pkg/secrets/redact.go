@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+const mask = "******"
+
+var (
+	mu      sync.RWMutex
+	secrets [][]byte
+	// URL中常见的带凭证的参数，如钉钉的access_token、企业微信的key、预签名地址的签名；
+	// 只匹配?或&之后的参数名，日志中的[key:xxx]、secret_key=等不受影响
+	queryRe = regexp.MustCompile(`(?i)([?&](?:access_token|token|key|sign|signature|x-amz-signature|x-amz-credential|q-signature|accesskeyid)=)[^&\s"'\]]+`)
+)
+
+// Register 注册需要在日志中隐藏的值，太短的值容易误伤，忽略
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, v := range values {
+		if len(v) < 6 {
+			continue
+		}
+		secrets = append(secrets, []byte(v))
+	}
+	// 长的先替换，避免一个值是另一个值的子串时只替换一部分
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// Redact 把注册过的值和URL中的凭证参数替换成******
+func Redact(msg []byte) []byte {
+	mu.RLock()
+	for _, s := range secrets {
+		if bytes.Contains(msg, s) {
+			msg = bytes.Replace(msg, s, []byte(mask), -1)
+		}
+	}
+	mu.RUnlock()
+	return queryRe.ReplaceAll(msg, []byte("${1}"+mask))
+}
+
+// RedactString Redact的字符串版本
+func RedactString(s string) string {
+	return string(Redact([]byte(s)))
+}
+
+type redactBackend struct {
+	logger.Backend // 借用空的multiBackend实现logger.Backend中未导出的close
+	w              io.Writer
+}
+
+func (b *redactBackend) Log(_ logger.Severity, msg []byte) {
+	b.w.Write(Redact(msg))
+}
+
+// RedactLogs 替换toolkits logger的输出，所有日志经过Redact后写到标准错误；
+// 标准输出留给数据(如download不带-o时输出的dump)，不能混入日志
+func RedactLogs(level interface{}) {
+	base, _ := logger.NewMultiBackend()
+	logger.SetLogging(level, &redactBackend{Backend: base, w: os.Stderr})
+}
@@ -0,0 +1,207 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoCredential 所有来源都没有提供凭证
+var ErrNoCredential = errors.New("no credential provided")
+
+// Credential 对象存储的访问凭证
+type Credential struct {
+	SecretID  string `json:"secret_id"`
+	SecretKey string `json:"secret_key"`
+}
+
+func (c Credential) empty() bool {
+	return c.SecretID == "" && c.SecretKey == ""
+}
+
+// Source 凭证的一个来源，没有配置时返回空的Credential
+type Source interface {
+	Name() string
+	Load() (Credential, error)
+}
+
+type values struct {
+	name string
+	cred Credential
+}
+
+func (s values) Name() string              { return s.name }
+func (s values) Load() (Credential, error) { return s.cred, nil }
+
+// FromValues 命令行、配置文件或DUMP_HANDLER_*环境变量中直接给出的值
+func FromValues(name, id, key string) Source {
+	return values{name: name, cred: Credential{SecretID: id, SecretKey: key}}
+}
+
+func readTrim(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+type files struct {
+	idFile, keyFile string
+}
+
+func (s files) Name() string { return "files" }
+
+func (s files) Load() (Credential, error) {
+	var c Credential
+	var err error
+	if s.idFile != "" {
+		if c.SecretID, err = readTrim(s.idFile); err != nil {
+			return c, err
+		}
+	}
+	if s.keyFile != "" {
+		if c.SecretKey, err = readTrim(s.keyFile); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// FromFiles 分别从两个文件读取，如挂载的secret中的单个key
+func FromFiles(idFile, keyFile string) Source {
+	return files{idFile: idFile, keyFile: keyFile}
+}
+
+// 各家SDK习惯的命名，凭证JSON和secret目录都按顺序查找
+var (
+	idNames  = []string{"secret_id", "SecretId", "access_key_id", "AccessKeyId"}
+	keyNames = []string{"secret_key", "SecretKey", "secret_access_key", "AccessKeySecret"}
+)
+
+type dir struct {
+	path string
+}
+
+func (s dir) Name() string { return "dir:" + s.path }
+
+func (s dir) Load() (Credential, error) {
+	var c Credential
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		return c, nil
+	}
+	pick := func(names []string) (string, error) {
+		for _, n := range names {
+			v, err := readTrim(filepath.Join(s.path, n))
+			if err == nil {
+				return v, nil
+			}
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+	var err error
+	if c.SecretID, err = pick(idNames); err != nil {
+		return c, err
+	}
+	c.SecretKey, err = pick(keyNames)
+	return c, err
+}
+
+// FromDir Kubernetes secret挂载的目录，每个key一个文件，如 /var/run/secrets/dump-handler/secret_id，目录不存在时跳过
+func FromDir(path string) Source {
+	return dir{path: path}
+}
+
+type jsonFile struct {
+	path string
+}
+
+func (s jsonFile) Name() string { return "json:" + s.path }
+
+func (s jsonFile) Load() (Credential, error) {
+	var c Credential
+	if s.path == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return c, err
+	}
+	m := map[string]string{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return c, fmt.Errorf("%s: %v", s.path, err)
+	}
+	for _, n := range idNames {
+		if v := m[n]; v != "" && c.SecretID == "" {
+			c.SecretID = v
+		}
+	}
+	for _, n := range keyNames {
+		if v := m[n]; v != "" && c.SecretKey == "" {
+			c.SecretKey = v
+		}
+	}
+	return c, nil
+}
+
+// FromJSON 凭证JSON文件，如 {"secret_id":"...","secret_key":"..."}
+func FromJSON(path string) Source {
+	return jsonFile{path: path}
+}
+
+type envPair struct {
+	id, key string
+}
+
+type env struct {
+	pairs []envPair
+}
+
+func (s env) Name() string { return "env" }
+
+func (s env) Load() (Credential, error) {
+	for _, p := range s.pairs {
+		c := Credential{SecretID: os.Getenv(p.id), SecretKey: os.Getenv(p.key)}
+		if !c.empty() {
+			return c, nil
+		}
+	}
+	return Credential{}, nil
+}
+
+// FromCloudEnv 各云厂商SDK约定的环境变量
+func FromCloudEnv() Source {
+	return env{pairs: []envPair{
+		{"TENCENTCLOUD_SECRET_ID", "TENCENTCLOUD_SECRET_KEY"},
+		{"ALIBABA_CLOUD_ACCESS_KEY_ID", "ALIBABA_CLOUD_ACCESS_KEY_SECRET"},
+		{"OSS_ACCESS_KEY_ID", "OSS_ACCESS_KEY_SECRET"},
+		{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"},
+	}}
+}
+
+// Resolve 按顺序取第一个提供了凭证的来源，只提供了一半时报错，都没有时返回ErrNoCredential。
+// 取到的凭证会注册到Redact中
+func Resolve(sources ...Source) (Credential, string, error) {
+	for _, s := range sources {
+		c, err := s.Load()
+		if err != nil {
+			return Credential{}, s.Name(), fmt.Errorf("load credential from %s: %v", s.Name(), err)
+		}
+		if c.empty() {
+			continue
+		}
+		if c.SecretID == "" || c.SecretKey == "" {
+			return Credential{}, s.Name(), fmt.Errorf("credential from %s is incomplete, both secret id and key are required", s.Name())
+		}
+		Register(c.SecretID, c.SecretKey)
+		return c, s.Name(), nil
+	}
+	return Credential{}, "", ErrNoCredential
+}
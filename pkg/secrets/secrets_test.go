@@ -0,0 +1,59 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveOrder(t *testing.T) {
+	dir := t.TempDir()
+	k8s := filepath.Join(dir, "k8s")
+	os.Mkdir(k8s, 0755)
+	ioutil.WriteFile(filepath.Join(k8s, "secret_id"), []byte("id-from-dir\n"), 0600)
+	ioutil.WriteFile(filepath.Join(k8s, "secret_key"), []byte("key-from-dir\n"), 0600)
+	js := filepath.Join(dir, "cred.json")
+	ioutil.WriteFile(js, []byte(`{"access_key_id":"id-from-json","secret_access_key":"key-from-json"}`), 0600)
+
+	c, from, err := Resolve(FromValues("flags", "", ""), FromJSON(""), FromDir(filepath.Join(dir, "missing")), FromDir(k8s), FromJSON(js))
+	if err != nil || from != "dir:"+k8s || c.SecretID != "id-from-dir" || c.SecretKey != "key-from-dir" {
+		t.Fatalf("got %+v from %s, err %v", c, from, err)
+	}
+	c, _, err = Resolve(FromJSON(js), FromDir(k8s))
+	if err != nil || c.SecretKey != "key-from-json" {
+		t.Fatalf("got %+v, err %v", c, err)
+	}
+	if _, _, err := Resolve(FromValues("flags", "only-id", "")); err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Fatalf("expected incomplete error, got %v", err)
+	}
+	if _, _, err := Resolve(FromValues("flags", "", ""), FromCloudEnv()); err != ErrNoCredential {
+		t.Fatalf("expected ErrNoCredential, got %v", err)
+	}
+	if _, _, err := Resolve(FromFiles(filepath.Join(dir, "nope"), "")); err == nil {
+		t.Fatal("expected error for missing secret file")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	Register("6vTmoa5JGwMVMxHK", "short")
+	got := RedactString(`upload failed key=6vTmoa5JGwMVMxHK url=https://oapi.dingtalk.com/robot/send?access_token=abcd&sign=xyz short [key:ka/env/jvm/pod]`)
+	if strings.Contains(got, "6vTmoa5JGwMVMxHK") || strings.Contains(got, "abcd") || strings.Contains(got, "xyz") {
+		t.Fatalf("secret leaked: %s", got)
+	}
+	if !strings.Contains(got, "short") || !strings.Contains(got, "[key:ka/env/jvm/pod]") {
+		t.Fatalf("redacted too much: %s", got)
+	}
+
+	// 参数名只在?或&之后匹配
+	if got := RedactString("monkey=ok secret_key=ok hotkey=ok"); got != "monkey=ok secret_key=ok hotkey=ok" {
+		t.Fatalf("redacted non-query text: %s", got)
+	}
+	// 整个webhook地址注册后，路径中的token也被隐藏
+	Register("https://hooks.slack.com/services/T000/B000/XXXXXXXX")
+	got = RedactString(`Post "https://hooks.slack.com/services/T000/B000/XXXXXXXX": dial tcp: timeout`)
+	if strings.Contains(got, "XXXXXXXX") {
+		t.Fatalf("webhook leaked: %s", got)
+	}
+}
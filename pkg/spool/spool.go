@@ -0,0 +1,166 @@
+package spool
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 每个任务在spool目录下对应:
+//
+//	<id>.json  任务描述
+//	<id>.data  随任务保存的文件(如dump)，可选
+//	<id>.*     处理过程中产生的其他文件(如断点记录)，任务完成时一起删除
+const (
+	jobExt  = ".json"
+	dataExt = ".data"
+)
+
+// Job 一个待重放的任务，Payload的格式由Kind决定
+type Job struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Created   time.Time       `json:"created"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	HasData   bool            `json:"has_data,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Spool 持久化的任务目录，应放在hostPath或PVC上，pod删除后仍然保留
+type Spool struct {
+	dir string
+}
+
+// Open 目录不存在时创建
+func Open(dir string) (*Spool, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("spool dir is empty")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Spool{dir: dir}, nil
+}
+
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().Format("20060102150405") + "-" + hex.EncodeToString(b)
+}
+
+// Put 记录一个任务，file不为空时把文件链接或复制到spool目录，原文件被删除后任务仍然可以重放
+func (s *Spool) Put(kind string, payload interface{}, file string) (*Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{ID: newID(), Kind: kind, Created: time.Now(), Payload: raw}
+	if file != "" {
+		if err := linkOrCopy(file, s.DataPath(job)); err != nil {
+			os.Remove(s.DataPath(job))
+			return nil, fmt.Errorf("spool %s: %v", file, err)
+		}
+		job.HasData = true
+	}
+	if err := s.Update(job); err != nil {
+		os.Remove(s.DataPath(job))
+		return nil, err
+	}
+	return job, nil
+}
+
+// DataPath 随任务保存的文件
+func (s *Spool) DataPath(job *Job) string {
+	return filepath.Join(s.dir, job.ID+dataExt)
+}
+
+// Update 原子地写入任务描述，用于记录重试次数和错误
+func (s *Spool) Update(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, job.ID+jobExt)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Jobs 按创建时间排序的全部任务，无法解析的任务描述跳过
+func (s *Spool) Jobs() ([]*Job, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*"+jobExt))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(matches))
+	for _, m := range matches {
+		data, err := ioutil.ReadFile(m)
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil || job.ID == "" {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs, nil
+}
+
+// Remove 删除任务及其相关的所有文件
+func (s *Spool) Remove(job *Job) error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, job.ID+".*"))
+	if err != nil {
+		return err
+	}
+	// 最后删除任务描述，中途失败下次还能看到该任务
+	sort.Slice(matches, func(i, j int) bool {
+		return !strings.HasSuffix(matches[i], jobExt) && strings.HasSuffix(matches[j], jobExt)
+	})
+	for _, m := range matches {
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,99 @@
+package spool
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type payload struct {
+	Key string `json:"key"`
+}
+
+func TestPutJobsRemove(t *testing.T) {
+	sp, err := Open(filepath.Join(t.TempDir(), "spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "oom.hprof")
+	if err := ioutil.WriteFile(src, []byte("JAVA PROFILE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := sp.Put("upload", payload{Key: "ka/env/jvm/pod"}, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 原文件删除后数据仍在spool中
+	os.Remove(src)
+	if data, err := ioutil.ReadFile(sp.DataPath(first)); err != nil || string(data) != "JAVA PROFILE" {
+		t.Fatalf("data file got %q, %v", data, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	second, err := sp.Put("alarm", payload{Key: "alarm"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 无法解析的任务描述跳过
+	ioutil.WriteFile(filepath.Join(sp.Dir(), "broken.json"), []byte("{"), 0644)
+
+	jobs, err := sp.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != first.ID || jobs[1].ID != second.ID {
+		t.Fatalf("jobs not sorted by creation: %+v", jobs)
+	}
+	var p payload
+	if err := json.Unmarshal(jobs[0].Payload, &p); err != nil || p.Key != "ka/env/jvm/pod" || !jobs[0].HasData {
+		t.Fatalf("payload got %+v %v, job %+v", p, err, jobs[0])
+	}
+	if jobs[1].HasData {
+		t.Fatal("job without file should not have data")
+	}
+
+	// 失败次数和错误记录在任务描述中
+	for i := 0; i < 3; i++ {
+		jobs[0].Attempts++
+		jobs[0].LastError = "connection reset"
+		if err := sp.Update(jobs[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs, _ = sp.Jobs()
+	if jobs[0].Attempts != 3 || jobs[0].LastError != "connection reset" {
+		t.Fatalf("attempts not persisted: %+v", jobs[0])
+	}
+
+	// 处理过程中产生的断点文件一起删除
+	ioutil.WriteFile(sp.DataPath(first)+".cp", []byte("{}"), 0644)
+	if err := sp.Remove(first); err != nil {
+		t.Fatal(err)
+	}
+	left, _ := filepath.Glob(filepath.Join(sp.Dir(), first.ID+".*"))
+	if len(left) != 0 {
+		t.Fatalf("files left after remove: %v", left)
+	}
+	jobs, _ = sp.Jobs()
+	if len(jobs) != 1 || jobs[0].ID != second.ID {
+		t.Fatalf("jobs after remove: %+v", jobs)
+	}
+}
+
+func TestPutMissingFile(t *testing.T) {
+	sp, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sp.Put("upload", payload{}, filepath.Join(sp.Dir(), "missing")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if jobs, _ := sp.Jobs(); len(jobs) != 0 {
+		t.Fatalf("failed put should not leave a job: %+v", jobs)
+	}
+	if _, err := Open(""); err == nil {
+		t.Fatal("expected error for empty dir")
+	}
+}
@@ -0,0 +1,181 @@
+package threaddump
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// Marker 线程dump的开头，如 "Full thread dump OpenJDK 64-Bit Server VM (17.0.2+8 mixed mode):"
+const Marker = "Full thread dump"
+
+// Options 抓取参数
+type Options struct {
+	Jcmd    string        // jcmd命令，为空或找不到时发送SIGQUIT
+	Output  string        // SIGQUIT时JVM写线程dump的文件，为空时使用进程的stdout(/proc/<pid>/fd/1)
+	Timeout time.Duration // 等待线程dump写完的最长时间
+	Settle  time.Duration // 输出文件多久不再增长视为写完
+}
+
+// DefaultOptions 默认参数
+var DefaultOptions = Options{Jcmd: "jcmd", Timeout: 10 * time.Second, Settle: 500 * time.Millisecond}
+
+// Capture 抓取一次线程dump，优先使用jcmd Thread.print，失败时发送SIGQUIT并从输出文件中截取
+func Capture(ctx context.Context, pid int, opt Options) ([]byte, error) {
+	if opt.Jcmd != "" {
+		if path, err := exec.LookPath(opt.Jcmd); err == nil {
+			out, err := jcmd(ctx, path, pid, opt.Timeout)
+			if err == nil {
+				return out, nil
+			}
+			logger.Warningf("[thread_dump][jcmd][pid:%d][err:%v], fall back to SIGQUIT", pid, err)
+		}
+	}
+	return sigquit(ctx, pid, opt)
+}
+
+// jcmd需要与JVM同一用户、共享/tmp，sidecar中通常不满足
+func jcmd(ctx context.Context, path string, pid int, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, strconv.Itoa(pid), "Thread.print", "-l").Output()
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.Index(out, []byte(Marker))
+	if i < 0 {
+		return nil, fmt.Errorf("no thread dump in jcmd output: %.200s", out)
+	}
+	return out[lineStart(out, i):], nil
+}
+
+// catchesSIGQUIT 进程是否注册了SIGQUIT的处理函数(/proc/<pid>/status的SigCgt)，
+// 没有注册时SIGQUIT的默认动作是退出并产生core，不能发送
+func catchesSIGQUIT(pid int) (bool, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "SigCgt:") {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "SigCgt:")), 16, 64)
+		if err != nil {
+			return false, fmt.Errorf("parse SigCgt of %d: %v", pid, err)
+		}
+		return mask&(1<<(uint(syscall.SIGQUIT)-1)) != 0, nil
+	}
+	return false, fmt.Errorf("no SigCgt in /proc/%d/status", pid)
+}
+
+// sigquit JVM收到SIGQUIT后把线程dump写到stdout，记录输出文件当前的大小，读取之后追加的内容
+func sigquit(ctx context.Context, pid int, opt Options) ([]byte, error) {
+	// -Xrs或非java进程没有处理SIGQUIT，发送会直接杀掉进程
+	ok, err := catchesSIGQUIT(pid)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("process %d does not handle SIGQUIT, refusing to send it", pid)
+	}
+	path := opt.Output
+	if path == "" {
+		path = fmt.Sprintf("/proc/%d/fd/1", pid)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// stdout是管道(容器日志)时读取会抢走JVM的输出
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file, redirect the JVM stdout to a file or set the output file", path)
+	}
+	start := fi.Size()
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Signal(syscall.SIGQUIT); err != nil {
+		return nil, fmt.Errorf("send SIGQUIT to %d: %v", pid, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opt.Timeout)
+	defer cancel()
+	ticker := time.NewTicker(opt.Settle)
+	defer ticker.Stop()
+	size := start
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no complete thread dump in %s: %v", path, ctx.Err())
+		case <-ticker.C:
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() < start {
+			return nil, fmt.Errorf("%s truncated while waiting for the thread dump", path)
+		}
+		// 出现线程dump并且一个Settle周期内不再增长
+		if fi.Size() == size && size > start {
+			data, err := ioutil.ReadAll(io.NewSectionReader(f, start, size-start))
+			if err != nil {
+				return nil, err
+			}
+			if i := bytes.Index(data, []byte(Marker)); i >= 0 {
+				return data[lineStart(data, i):], nil
+			}
+		}
+		size = fi.Size()
+	}
+}
+
+// lineStart 线程dump前一行是JVM打印的时间，一起保留
+func lineStart(data []byte, i int) int {
+	prev := bytes.LastIndexByte(data[:i], '\n')
+	if prev < 0 {
+		return 0
+	}
+	if ts := bytes.LastIndexByte(data[:prev], '\n'); ts >= 0 {
+		return ts + 1
+	}
+	return 0
+}
+
+// FindJVM 找到第一个java进程，sidecar需要shareProcessNamespace
+func FindJVM() (int, error) {
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return 0, err
+	}
+	self := os.Getpid()
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil || pid == self {
+			continue
+		}
+		comm, err := ioutil.ReadFile(filepath.Join(dir, "comm"))
+		if err == nil && strings.TrimSpace(string(comm)) == "java" {
+			return pid, nil
+		}
+	}
+	return 0, fmt.Errorf("no java process found")
+}
@@ -0,0 +1,80 @@
+package threaddump
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 收到SIGQUIT时像JVM一样在stdout打印时间和线程dump
+const fakeJVM = `echo starting; trap 'printf "2021-06-01 12:00:00\nFull thread dump Fake VM:\n\n\"main\" #1 prio=5\n"' QUIT; while :; do sleep 0.05; done`
+
+func TestCaptureSIGQUIT(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	cmd := exec.Command("sh", "-c", fakeJVM)
+	cmd.Stdout = out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	time.Sleep(200 * time.Millisecond)
+
+	opt := Options{Timeout: 5 * time.Second, Settle: 100 * time.Millisecond}
+	for i := 0; i < 2; i++ {
+		// 默认从/proc/<pid>/fd/1读取
+		got, err := Capture(context.Background(), cmd.Process.Pid, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "2021-06-01 12:00:00\nFull thread dump Fake VM:\n\n\"main\" #1 prio=5\n"; string(got) != want {
+			t.Fatalf("sample %d: got %q", i, got)
+		}
+	}
+
+	opt.Output, opt.Timeout = "/dev/null", 300*time.Millisecond
+	if _, err := Capture(context.Background(), cmd.Process.Pid, opt); err == nil {
+		t.Fatal("expected error for non regular output")
+	}
+}
+
+func TestCaptureRefusesWithoutHandler(t *testing.T) {
+	// 没有处理SIGQUIT的进程，发送会杀掉它
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	_, err := Capture(context.Background(), cmd.Process.Pid, Options{Output: "/dev/null", Timeout: time.Second, Settle: 10 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "SIGQUIT") {
+		t.Fatalf("expected refusal, got %v", err)
+	}
+	if err := cmd.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("process should still be alive: %v", err)
+	}
+}
+
+func TestCaptureJcmd(t *testing.T) {
+	dir := t.TempDir()
+	jcmd := filepath.Join(dir, "jcmd")
+	ioutil.WriteFile(jcmd, []byte("#!/bin/sh\nprintf \"$1:\\n2021-06-01 12:00:00\\nFull thread dump Fake VM:\\n\"\n"), 0755)
+	got, err := Capture(context.Background(), 42, Options{Jcmd: jcmd, Timeout: 5 * time.Second})
+	if err != nil || string(got) != "2021-06-01 12:00:00\nFull thread dump Fake VM:\n" {
+		t.Fatalf("got %q %v", got, err)
+	}
+
+	// jcmd失败时退回SIGQUIT，进程不存在时报错
+	ioutil.WriteFile(jcmd, []byte("#!/bin/sh\necho 'com.sun.tools.attach.AttachNotSupportedException'; exit 1\n"), 0755)
+	if _, err := Capture(context.Background(), 1<<30, Options{Jcmd: jcmd, Timeout: time.Second, Settle: 10 * time.Millisecond}); err == nil || !strings.Contains(err.Error(), "/proc/1073741824") {
+		t.Fatalf("expected SIGQUIT fallback error, got %v", err)
+	}
+}
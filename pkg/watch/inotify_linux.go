@@ -0,0 +1,39 @@
+package watch
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// notify 用inotify监听目录中文件的创建、写完和移入，每次变化向返回的chan发送一个信号
+func notify(dir string) (<-chan struct{}, func(), error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+	mask := uint32(syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO)
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		syscall.Close(fd)
+		return nil, nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// 非阻塞的fd交给runtime的poller，Close时Read返回
+	f := os.NewFile(uintptr(fd), "inotify")
+	ch := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			// 不关心具体是哪个文件，只需要触发重新扫描，多个事件合并成一个
+			if _, err := f.Read(buf); err != nil {
+				logger.Debugf("[watch][inotify_closed][err:%v]", err)
+				return
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, func() { f.Close() }, nil
+}
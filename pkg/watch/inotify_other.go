@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import "errors"
+
+func notify(dir string) (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("inotify is only supported on linux")
+}
@@ -0,0 +1,167 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// 处理完的文件加上的后缀，扫描时跳过
+const (
+	DoneSuffix   = ".done"
+	FailedSuffix = ".failed"
+)
+
+// 处理完之后对文件的操作
+const (
+	AfterRename = "rename" // 默认，重命名为<文件名>.done，JVM不会覆盖已存在的HeapDumpPath，重命名后下次OOM可以再次写入；.done不会清理，本地保留一份
+	AfterDelete = "delete" // 上传后删除，多次OOM不会占满emptyDir，但上传后本地不再有副本
+)
+
+// Options 监听参数
+type Options struct {
+	Dir          string        // 包含通配符时每次扫描重新展开，如节点上所有pod的emptyDir，此时只轮询
+	Patterns     []string      // 文件名的glob，如 *.hprof
+	PollInterval time.Duration // 轮询间隔，inotify可用时用于兜底
+	NoInotify    bool          // 只轮询，用于不支持inotify的文件系统(NFS等)
+	After        string        // rename、delete
+	MaxAttempts  int           // 连续失败多少次后重命名为<文件名>.failed，不再处理
+}
+
+// Handler 处理一个dump，返回错误时下次扫描重试
+type Handler func(path string) error
+
+// Watcher 监听目录中新出现的dump
+type Watcher struct {
+	opt      Options
+	attempts map[string]int
+}
+
+func New(opt Options) *Watcher {
+	if opt.PollInterval <= 0 {
+		opt.PollInterval = 10 * time.Second
+	}
+	if opt.After == "" {
+		opt.After = AfterRename
+	}
+	if opt.MaxAttempts <= 0 {
+		opt.MaxAttempts = 3
+	}
+	return &Watcher{opt: opt, attempts: map[string]int{}}
+}
+
+// Match 文件名是否匹配Patterns，跳过处理过的文件和断点续传的记录
+func (w *Watcher) Match(name string) bool {
+	for _, suffix := range []string{DoneSuffix, FailedSuffix, ".cp"} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	for _, p := range w.opt.Patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) isGlob() bool {
+	return strings.ContainsAny(w.opt.Dir, "*?[")
+}
+
+type file struct {
+	path string
+	mod  time.Time
+}
+
+// Scan 处理目录中所有匹配的文件，按修改时间先后依次处理
+func (w *Watcher) Scan(handle Handler) error {
+	dirs := []string{w.opt.Dir}
+	if w.isGlob() {
+		var err error
+		if dirs, err = filepath.Glob(w.opt.Dir); err != nil {
+			return err
+		}
+	}
+	var files []file
+	for _, dir := range dirs {
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if w.isGlob() {
+				// pod删除时目录随时会被回收
+				continue
+			}
+			return err
+		}
+		for _, fi := range fis {
+			if fi.Mode().IsRegular() && w.Match(fi.Name()) {
+				files = append(files, file{filepath.Join(dir, fi.Name()), fi.ModTime()})
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+	for _, f := range files {
+		w.process(f.path, handle)
+	}
+	return nil
+}
+
+func (w *Watcher) process(path string, handle Handler) {
+	logger.Infof("[watch][found][path:%s]", path)
+	if err := handle(path); err != nil {
+		w.attempts[path]++
+		logger.Errorf("[watch][failed][path:%s][attempts:%d][err:%v]", path, w.attempts[path], err)
+		if w.attempts[path] >= w.opt.MaxAttempts {
+			delete(w.attempts, path)
+			if err := os.Rename(path, path+FailedSuffix); err != nil {
+				logger.Errorf("[watch][mark_failed][path:%s][err:%v]", path, err)
+			}
+		}
+		return
+	}
+	delete(w.attempts, path)
+	var err error
+	if w.opt.After == AfterDelete {
+		err = os.Remove(path)
+	} else {
+		err = os.Rename(path, path+DoneSuffix)
+	}
+	if err != nil {
+		logger.Errorf("[watch][mark_done][path:%s][err:%v]", path, err)
+		return
+	}
+	logger.Infof("[watch][done][path:%s][after:%s]", path, w.opt.After)
+}
+
+// Run 启动时先扫描一次，之后每当inotify报告目录变化或到了轮询间隔时重新扫描，直到ctx结束
+func (w *Watcher) Run(ctx context.Context, handle Handler) error {
+	var events <-chan struct{}
+	if !w.opt.NoInotify && !w.isGlob() {
+		ch, stop, err := notify(w.opt.Dir)
+		if err != nil {
+			logger.Warningf("[watch][inotify_unavailable][dir:%s][err:%v], polling every %v", w.opt.Dir, err, w.opt.PollInterval)
+		} else {
+			defer stop()
+			events = ch
+		}
+	}
+	ticker := time.NewTicker(w.opt.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.Scan(handle); err != nil {
+			logger.Errorf("[watch][scan][dir:%s][err:%v]", w.opt.Dir, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-events:
+		case <-ticker.C:
+		}
+	}
+}
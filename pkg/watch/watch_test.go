@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.hprof", "b.hprof", "oom", "b.hprof.cp", "old.hprof.done", "gc.log"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+	w := New(Options{Dir: dir, Patterns: []string{"*.hprof", "oom"}, MaxAttempts: 2, After: AfterRename})
+	var seen []string
+	fail := errors.New("upload failed")
+	handle := func(path string) error {
+		seen = append(seen, filepath.Base(path))
+		if filepath.Base(path) == "b.hprof" {
+			return fail
+		}
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.Scan(handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a.hprof、oom处理一次，b.hprof失败两次后不再处理
+	if len(seen) != 4 {
+		t.Fatalf("seen %v", seen)
+	}
+	for _, name := range []string{"a.hprof.done", "oom.done", "b.hprof.failed", "b.hprof.cp", "gc.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is only supported on linux")
+	}
+	dir := t.TempDir()
+	// 轮询间隔很长，只能依靠inotify及时发现新文件
+	w := New(Options{Dir: dir, Patterns: []string{"*.hprof"}, PollInterval: time.Hour, After: AfterDelete})
+	done := make(chan string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, func(path string) error {
+		done <- filepath.Base(path)
+		return nil
+	})
+	time.Sleep(100 * time.Millisecond)
+	ioutil.WriteFile(filepath.Join(dir, "new.hprof"), []byte("x"), 0644)
+	select {
+	case name := <-done:
+		if name != "new.hprof" {
+			t.Fatal(name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("new dump not picked up")
+	}
+}
+
+func TestScanGlob(t *testing.T) {
+	root := t.TempDir()
+	for _, pod := range []string{"u-1", "u-2"} {
+		dir := filepath.Join(root, pod, "dumps")
+		os.MkdirAll(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, "oom"), []byte(pod), 0644)
+	}
+	w := New(Options{Dir: filepath.Join(root, "*", "dumps"), Patterns: []string{"oom"}})
+	n := 0
+	if err := w.Scan(func(path string) error { n++; return nil }); err != nil || n != 2 {
+		t.Fatalf("handled %d: %v", n, err)
+	}
+}
@@ -0,0 +1,87 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// Alert Alertmanager v2 API的告警
+// 文档: https://github.com/prometheus/alertmanager/blob/main/api/v2/openapi.yaml
+type Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// Client 同时发送到多个Alertmanager，与Prometheus一样由Alertmanager集群去重
+type Client struct {
+	urls   []string // http://alertmanager:9093
+	client *http.Client
+}
+
+func NewClient(urls []string) *Client {
+	trimmed := make([]string, 0, len(urls))
+	for _, u := range urls {
+		trimmed = append(trimmed, strings.TrimSuffix(u, "/"))
+	}
+	return &Client{urls: trimmed, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *Client) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url+"/api/v2/alerts", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("alertmanager %s returned HTTP status %s: %s", url, resp.Status, bytes.TrimSpace(data))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// Post 并发发送到所有Alertmanager，至少一个成功即返回nil，全部失败时返回各自的错误
+func (c *Client) Post(ctx context.Context, alerts []Alert) error {
+	if len(c.urls) == 0 {
+		return fmt.Errorf("no alertmanager configured")
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, len(c.urls))
+	for _, u := range c.urls {
+		go func(u string) {
+			errs <- c.post(ctx, u, body)
+		}(u)
+	}
+	var msgs []string
+	for range c.urls {
+		if err := <-errs; err != nil {
+			logger.Warningf("[alertmanager_post_error][err:%v]", err)
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) == len(c.urls) {
+		return fmt.Errorf("all alertmanagers failed: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPost(t *testing.T) {
+	var got []Alert
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer ok.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	alerts := []Alert{{
+		Labels:      map[string]string{"alertname": "JvmOOMDump", "pod": "ops-demo-1"},
+		Annotations: map[string]string{"summary": "oom"},
+		StartsAt:    now,
+		EndsAt:      now.Add(time.Hour),
+	}}
+	// 一个Alertmanager不可用不影响整体
+	if err := NewClient([]string{down.URL, ok.URL + "/"}).Post(context.Background(), alerts); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Labels["pod"] != "ops-demo-1" || !got[0].EndsAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected alerts: %+v", got)
+	}
+	if err := NewClient([]string{down.URL}).Post(context.Background(), alerts); err == nil {
+		t.Fatal("expected error when all alertmanagers fail")
+	}
+}
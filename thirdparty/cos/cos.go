@@ -1,28 +1,49 @@
 package cos
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"dump-handler/pkg/envelope"
+	"dump-handler/thirdparty/storage"
+
 	"github.com/tencentyun/cos-go-sdk-v5"
 )
 
-func DownloadCOSBucket(cosURL, secretID, secretKey, fileName string) (io.ReadCloser, error) {
-	u, _ := url.Parse(cosURL)
+const metaPrefix = "x-cos-meta-"
+
+func init() {
+	storage.Register("cos", newBackend)
+}
+
+func newClient(cosURL, secretID, secretKey string) (*cos.Client, error) {
+	u, err := url.Parse(cosURL)
+	if err != nil {
+		return nil, err
+	}
 	b := &cos.BaseURL{BucketURL: u}
+	// 不设置http.Client.Timeout，它包含读写body的时间，大文件会被中断
 	c := cos.NewClient(b, &http.Client{
-		Timeout: 100 * time.Second,
 		Transport: &cos.AuthorizationTransport{
-			//SecretID: os.Getenv(secretID),
-			SecretID: secretID,
-			//SecretKey: os.Getenv(secretKey),
+			SecretID:  secretID,
 			SecretKey: secretKey,
+			Transport: storage.NewTransport(),
 		},
 	})
+	return c, nil
+}
 
+func DownloadCOSBucket(cosURL, secretID, secretKey, fileName string) (io.ReadCloser, error) {
+	c, err := newClient(cosURL, secretID, secretKey)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := c.Object.Get(context.Background(), fileName, nil)
 	if err != nil {
 		return nil, err
@@ -30,19 +51,231 @@ func DownloadCOSBucket(cosURL, secretID, secretKey, fileName string) (io.ReadClo
 	return resp.Body, nil
 }
 
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// DownloadCOSBucketDecrypt 下载客户端加密过的对象并解密
+func DownloadCOSBucketDecrypt(cosURL, secretID, secretKey, fileName string, kw envelope.KeyWrapper) (io.ReadCloser, error) {
+	body, err := DownloadCOSBucket(cosURL, secretID, secretKey, fileName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := envelope.NewReader(context.Background(), body, kw)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return readCloser{r, body}, nil
+}
+
 func Upload(cosURL, secretID, secretKey, bucketName string, file io.Reader) error {
-	u, _ := url.Parse(cosURL)
-	b := &cos.BaseURL{BucketURL: u}
-	c := cos.NewClient(b, &http.Client{
-		Timeout: 100 * time.Second,
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  secretID,
-			SecretKey: secretKey,
-		},
-	})
-	_, err := c.Object.Put(context.Background(), bucketName, file, nil)
+	c, err := newClient(cosURL, secretID, secretKey)
+	if err != nil {
+		return err
+	}
+	_, err = c.Object.Put(context.Background(), bucketName, file, nil)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// Backend 腾讯云COS实现的storage.Backend
+// 目标地址: cos://<BucketName-APPID>.cos.<Region>.myqcloud.com
+type Backend struct {
+	bucketURL string
+	cred      storage.Credential
+	client    *cos.Client
+}
+
+func newBackend(u *url.URL, cred storage.Credential) (storage.Backend, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("cos target %q has no bucket host", u.String())
+	}
+	return NewBackend(fmt.Sprintf("https://%s", u.Host), cred)
+}
+
+// NewBackend 使用https形式的存储桶地址创建后端
+func NewBackend(bucketURL string, cred storage.Credential) (*Backend, error) {
+	c, err := newClient(bucketURL, cred.SecretID, cred.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{
+		bucketURL: strings.TrimSuffix(bucketURL, "/"),
+		cred:      cred,
+		client:    c,
+	}, nil
+}
+
+func putHeader(opts *storage.PutOptions) *cos.ObjectPutHeaderOptions {
+	h := &cos.ObjectPutHeaderOptions{}
+	if opts == nil {
+		return h
+	}
+	h.ContentType = opts.ContentType
+	h.ContentEncoding = opts.ContentEncoding
+	if len(opts.Metadata) > 0 {
+		meta := make(http.Header)
+		for k, v := range opts.Metadata {
+			meta.Set(metaPrefix+k, v)
+		}
+		h.XCosMetaXXX = &meta
+	}
+	return h
+}
+
+func (b *Backend) Put(ctx context.Context, key string, r io.Reader, opts *storage.PutOptions) error {
+	putOpts := &cos.ObjectPutOptions{ObjectPutHeaderOptions: putHeader(opts)}
+	if opts != nil && opts.Size > 0 {
+		putOpts.ContentLength = opts.Size
+	}
+	_, err := b.client.Object.Put(ctx, key, r, putOpts)
+	return err
+}
+
+func (b *Backend) InitiateMultipartUpload(ctx context.Context, key string, opts *storage.PutOptions) (string, error) {
+	res, _, err := b.client.Object.InitiateMultipartUpload(ctx, key, &cos.InitiateMultipartUploadOptions{
+		ObjectPutHeaderOptions: putHeader(opts),
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.UploadID, nil
+}
+
+func (b *Backend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	resp, err := b.client.Object.UploadPart(ctx, key, uploadID, partNumber, bytes.NewReader(data),
+		&cos.ObjectUploadPartOptions{ContentLength: int64(len(data))})
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (b *Backend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.Part) error {
+	opt := &cos.CompleteMultipartUploadOptions{}
+	for _, p := range parts {
+		opt.Parts = append(opt.Parts, cos.Object{PartNumber: p.PartNumber, ETag: p.ETag})
+	}
+	_, _, err := b.client.Object.CompleteMultipartUpload(ctx, key, uploadID, opt)
+	return err
+}
+
+func (b *Backend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := b.client.Object.AbortMultipartUpload(ctx, key, uploadID)
+	if cos.IsNotFoundError(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *Backend) ListMultipartUploads(ctx context.Context, prefix string) ([]storage.Upload, error) {
+	var list []storage.Upload
+	opt := &cos.ObjectListUploadsOptions{Prefix: prefix, MaxUploads: 1000}
+	for {
+		res, _, err := b.client.Object.ListUploads(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range res.Upload {
+			up := storage.Upload{Key: u.Key, UploadID: u.UploadID}
+			if t, err := time.Parse(time.RFC3339, u.Initiated); err == nil {
+				up.Initiated = t
+			}
+			list = append(list, up)
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		opt.KeyMarker = res.NextKeyMarker
+		opt.UploadIdMarker = res.NextUploadIdMarker
+	}
+}
+
+func (b *Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.client.Object.Get(ctx, key, nil)
+	if cos.IsNotFoundError(err) {
+		return nil, storage.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *Backend) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	resp, err := b.client.Object.Head(ctx, key, nil)
+	if cos.IsNotFoundError(err) {
+		return nil, storage.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &storage.ObjectInfo{
+		Key:             key,
+		Size:            resp.ContentLength,
+		ETag:            strings.Trim(resp.Header.Get("ETag"), `"`),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		Metadata:        make(map[string]string),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+	for k := range resp.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, metaPrefix) {
+			info.Metadata[strings.TrimPrefix(lk, metaPrefix)] = resp.Header.Get(k)
+		}
+	}
+	return info, nil
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var list []storage.ObjectInfo
+	opt := &cos.BucketGetOptions{Prefix: prefix, MaxKeys: 1000}
+	for {
+		res, _, err := b.client.Bucket.Get(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Contents {
+			info := storage.ObjectInfo{
+				Key:  o.Key,
+				Size: o.Size,
+				ETag: strings.Trim(o.ETag, `"`),
+			}
+			if t, err := time.Parse(time.RFC3339, o.LastModified); err == nil {
+				info.LastModified = t
+			}
+			list = append(list, info)
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		opt.Marker = res.NextMarker
+	}
+}
+
+func (b *Backend) Delete(ctx context.Context, key string) error {
+	_, err := b.client.Object.Delete(ctx, key)
+	if cos.IsNotFoundError(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *Backend) Presign(ctx context.Context, key string, expire time.Duration) (string, error) {
+	u, err := b.client.Object.GetPresignedURL(ctx, http.MethodGet, key, b.cred.SecretID, b.cred.SecretKey, expire, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (b *Backend) URL() string {
+	return b.bucketURL
+}
@@ -0,0 +1,256 @@
+package cos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dump-handler/thirdparty/storage"
+)
+
+// fakeCOS 本地替身，每页最多返回2条，覆盖翻页
+type fakeCOS struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+	uploads map[string]map[int][]byte
+	keys    map[string]string // uploadId -> key
+	nextID  int
+}
+
+func newFakeCOS() *fakeCOS {
+	return &fakeCOS{
+		objects: make(map[string][]byte),
+		headers: make(map[string]http.Header),
+		uploads: make(map[string]map[int][]byte),
+		keys:    make(map[string]string),
+	}
+}
+
+const pageSize = 2
+
+// setCRC SDK上传后校验响应中的crc64
+func setCRC(w http.ResponseWriter, data []byte) {
+	w.Header().Set("x-cos-hash-crc64ecma", strconv.FormatUint(crc64.Checksum(data, crc64.MakeTable(crc64.ECMA)), 10))
+}
+
+func (f *fakeCOS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), "q-ak=AKID") {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	q := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	_, uploads := q["uploads"]
+	switch {
+	case r.Method == http.MethodPost && uploads:
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		f.keys[id] = key
+		f.headers[key] = r.Header.Clone()
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, key, id)
+	case r.Method == http.MethodGet && uploads:
+		var ids []string
+		for id, k := range f.keys {
+			if strings.HasPrefix(k, q.Get("prefix")) && id > q.Get("upload-id-marker") {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		truncated := len(ids) > pageSize
+		if truncated {
+			ids = ids[:pageSize]
+		}
+		fmt.Fprint(w, `<ListMultipartUploadsResult>`)
+		for _, id := range ids {
+			fmt.Fprintf(w, `<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>2021-06-01T12:00:00Z</Initiated></Upload>`, f.keys[id], id)
+		}
+		if truncated {
+			fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextKeyMarker>%s</NextKeyMarker><NextUploadIdMarker>%s</NextUploadIdMarker>`, f.keys[ids[len(ids)-1]], ids[len(ids)-1])
+		}
+		fmt.Fprint(w, `</ListMultipartUploadsResult>`)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+		setCRC(w, body)
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		parts := f.uploads[q.Get("uploadId")]
+		nums := make([]int, 0, len(parts))
+		for n := range parts {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		var buf bytes.Buffer
+		for _, n := range nums {
+			buf.Write(parts[n])
+		}
+		delete(f.uploads, q.Get("uploadId"))
+		delete(f.keys, q.Get("uploadId"))
+		f.objects[key] = buf.Bytes()
+		setCRC(w, buf.Bytes())
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key><ETag>"etag-complete"</ETag></CompleteMultipartUploadResult>`, key)
+	case r.Method == http.MethodDelete && q.Get("uploadId") != "":
+		if _, ok := f.uploads[q.Get("uploadId")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchUpload</Code></Error>`)
+			return
+		}
+		delete(f.uploads, q.Get("uploadId"))
+		delete(f.keys, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.headers[key] = r.Header.Clone()
+		setCRC(w, body)
+	case r.Method == http.MethodGet && key == "":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, q.Get("prefix")) && k > q.Get("marker") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		truncated := len(keys) > pageSize
+		if truncated {
+			keys = keys[:pageSize]
+		}
+		fmt.Fprint(w, `<ListBucketResult>`)
+		for _, k := range keys {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><ETag>"e"</ETag><LastModified>2021-06-01T12:00:00Z</LastModified></Contents>`, k, len(f.objects[k]))
+		}
+		if truncated {
+			fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextMarker>%s</NextMarker>`, keys[len(keys)-1])
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		for k, v := range f.headers[key] {
+			if strings.HasPrefix(strings.ToLower(k), metaPrefix) {
+				w.Header()[k] = v
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestBackend(t *testing.T) (*Backend, *fakeCOS) {
+	fake := newFakeCOS()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	b, err := NewBackend(srv.URL, storage.Credential{SecretID: "AKID", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, fake
+}
+
+func TestPutStatListDelete(t *testing.T) {
+	b, _ := newTestBackend(t)
+	ctx := context.Background()
+	opts := &storage.PutOptions{Metadata: map[string]string{"pod": "ops-demo"}}
+	for _, k := range []string{"ka/env/jvm/a", "ka/env/jvm/b", "ka/env/jvm/c", "other/x"} {
+		if err := b.Put(ctx, k, strings.NewReader("hprof"), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := b.Stat(ctx, "ka/env/jvm/a")
+	if err != nil || info.Size != 5 || info.Metadata["pod"] != "ops-demo" {
+		t.Fatalf("unexpected stat %+v %v", info, err)
+	}
+	// 3个对象分两页返回
+	list, err := b.List(ctx, "ka/")
+	if err != nil || len(list) != 3 || list[2].Key != "ka/env/jvm/c" || list[0].ETag != "e" ||
+		!list[0].LastModified.Equal(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("list got %+v, %v", list, err)
+	}
+	if err := b.Delete(ctx, "ka/env/jvm/a"); err != nil {
+		t.Fatal(err)
+	}
+	// 已经不存在的对象删除成功
+	if err := b.Delete(ctx, "ka/env/jvm/a"); err != nil {
+		t.Fatalf("delete missing object: %v", err)
+	}
+	if _, err := b.Get(ctx, "ka/env/jvm/a"); err != storage.ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := b.Stat(ctx, "ka/env/jvm/a"); err != storage.ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+
+	bad, _ := NewBackend(strings.TrimSuffix(b.URL(), "/"), storage.Credential{SecretID: "wrong", SecretKey: "x"})
+	if err := bad.Put(ctx, "k", strings.NewReader("x"), nil); err == nil {
+		t.Fatal("expected access denied")
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	b, fake := newTestBackend(t)
+	ctx := context.Background()
+	var m storage.Multipart = b
+	id, err := m.InitiateMultipartUpload(ctx, "ka/env/jvm/big", &storage.PutOptions{Metadata: map[string]string{"pod": "ops-demo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []storage.Part
+	for i, chunk := range []string{"hea", "pdump"} {
+		etag, err := m.UploadPart(ctx, "ka/env/jvm/big", id, i+1, []byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, storage.Part{PartNumber: i + 1, ETag: etag})
+	}
+	if err := m.CompleteMultipartUpload(ctx, "ka/env/jvm/big", id, parts); err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.objects["ka/env/jvm/big"]) != "heapdump" {
+		t.Fatalf("object content %q", fake.objects["ka/env/jvm/big"])
+	}
+
+	// 翻页列出残留的分片上传，放弃后再放弃一次视为成功
+	for i := 0; i < 3; i++ {
+		m.InitiateMultipartUpload(ctx, fmt.Sprintf("ka/env/jvm/orphan-%d", i), nil)
+	}
+	uploads, err := m.ListMultipartUploads(ctx, "ka/")
+	if err != nil || len(uploads) != 3 || uploads[0].Initiated.IsZero() {
+		t.Fatalf("list uploads %+v %v", uploads, err)
+	}
+	n, err := storage.AbortOrphanUploads(ctx, m, "ka/", time.Hour, uploads[0].UploadID)
+	if err != nil || n != 2 || len(fake.uploads) != 1 {
+		t.Fatalf("aborted %d, err %v, left %v", n, err, fake.uploads)
+	}
+	if err := m.AbortMultipartUpload(ctx, uploads[1].Key, uploads[1].UploadID); err != nil {
+		t.Fatalf("abort twice: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package dingtalk
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robot 钉钉群自定义机器人
+// 文档: https://open.dingtalk.com/document/robots/custom-robot-access
+type Robot struct {
+	webhook   string   // https://oapi.dingtalk.com/robot/send?access_token=xxx
+	secret    string   // 安全设置选择"加签"时的密钥，SEC开头
+	atMobiles []string // 需要@的手机号
+	atAll     bool
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewRobot secret为空时不加签
+func NewRobot(webhook, secret string, atMobiles []string, atAll bool) *Robot {
+	return &Robot{
+		webhook:   webhook,
+		secret:    secret,
+		atMobiles: atMobiles,
+		atAll:     atAll,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		now:       time.Now,
+	}
+}
+
+type markdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type at struct {
+	AtMobiles []string `json:"atMobiles,omitempty"`
+	IsAtAll   bool     `json:"isAtAll"`
+}
+
+type message struct {
+	MsgType  string    `json:"msgtype"`
+	Markdown *markdown `json:"markdown"`
+	At       at        `json:"at"`
+}
+
+type response struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// Sign 加签: base64(HmacSHA256(timestamp + "\n" + secret))，timestamp为毫秒
+func Sign(timestamp int64, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (r *Robot) url() (string, error) {
+	if r.secret == "" {
+		return r.webhook, nil
+	}
+	u, err := url.Parse(r.webhook)
+	if err != nil {
+		return "", err
+	}
+	ts := r.now().UnixNano() / int64(time.Millisecond)
+	q := u.Query()
+	q.Set("timestamp", strconv.FormatInt(ts, 10))
+	q.Set("sign", Sign(ts, r.secret))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// SendMarkdown 发送markdown消息，需要@的手机号追加在正文末尾，否则钉钉不会提醒
+func (r *Robot) SendMarkdown(ctx context.Context, title, text string) error {
+	if len(r.atMobiles) > 0 {
+		mentions := make([]string, 0, len(r.atMobiles))
+		for _, m := range r.atMobiles {
+			mentions = append(mentions, "@"+m)
+		}
+		text += "\n\n" + strings.Join(mentions, " ")
+	}
+	body, err := json.Marshal(message{
+		MsgType:  "markdown",
+		Markdown: &markdown{Title: title, Text: text},
+		At:       at{AtMobiles: r.atMobiles, IsAtAll: r.atAll},
+	})
+	if err != nil {
+		return err
+	}
+	u, err := r.url()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("dingtalk returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	// 钉钉出错时HTTP状态码也是200，需要看errcode
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("dingtalk: decode response: %v", err)
+	}
+	if res.ErrCode != 0 {
+		return fmt.Errorf("dingtalk errcode %d: %s", res.ErrCode, res.ErrMsg)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package dingtalk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendMarkdown(t *testing.T) {
+	var got message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ts, _ := strconv.ParseInt(q.Get("timestamp"), 10, 64)
+		if q.Get("access_token") != "tk" || q.Get("sign") != Sign(ts, "SECxx") {
+			w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	r := NewRobot(srv.URL+"/robot/send?access_token=tk", "SECxx", []string{"13800000000"}, false)
+	if err := r.SendMarkdown(context.Background(), "OOM", "### OOM"); err != nil {
+		t.Fatal(err)
+	}
+	if got.MsgType != "markdown" || got.Markdown.Title != "OOM" || len(got.At.AtMobiles) != 1 ||
+		!strings.HasSuffix(got.Markdown.Text, "@13800000000") {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	bad := NewRobot(srv.URL+"/robot/send?access_token=tk", "wrong", nil, false)
+	if err := bad.SendMarkdown(context.Background(), "OOM", "x"); err == nil || !strings.Contains(err.Error(), "310000") {
+		t.Fatalf("expected errcode error, got %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// 签名参数带在webhook的query上
+	r := NewRobot("https://oapi.dingtalk.com/robot/send?access_token=x", "SEC1", nil, false)
+	r.now = func() time.Time { return time.Unix(1577262236, 757e6) }
+	u, _ := r.url()
+	if !strings.Contains(u, "timestamp=1577262236757") || !strings.Contains(u, "sign=") {
+		t.Fatalf("unexpected signed url: %s", u)
+	}
+}
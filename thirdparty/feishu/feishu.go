@@ -0,0 +1,119 @@
+package feishu
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Robot 飞书/Lark群自定义机器人
+// 文档: https://open.feishu.cn/document/client-docs/bot-v3/add-custom-bot
+type Robot struct {
+	webhook string // https://open.feishu.cn/open-apis/bot/v2/hook/xxx
+	secret  string // 安全设置选择"签名校验"时的密钥
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewRobot secret为空时不签名
+func NewRobot(webhook, secret string) *Robot {
+	return &Robot{
+		webhook: webhook,
+		secret:  secret,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+	}
+}
+
+// Sign 签名: 以 timestamp + "\n" + secret 为密钥对空串做HmacSHA256再base64，timestamp为秒
+func Sign(timestamp int64, secret string) string {
+	mac := hmac.New(sha256.New, []byte(strconv.FormatInt(timestamp, 10)+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type text struct {
+	Tag     string `json:"tag"`
+	Content string `json:"content"`
+}
+
+type element struct {
+	Tag     string `json:"tag"`
+	Content string `json:"content"`
+}
+
+type header struct {
+	Title    text   `json:"title"`
+	Template string `json:"template,omitempty"`
+}
+
+type card struct {
+	Header   header    `json:"header"`
+	Elements []element `json:"elements"`
+}
+
+type message struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	Sign      string `json:"sign,omitempty"`
+	MsgType   string `json:"msg_type"`
+	Card      *card  `json:"card"`
+}
+
+type response struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// SendMarkdown 以消息卡片发送，卡片的markdown元素支持[文字](链接)和<at id=all></at>
+func (r *Robot) SendMarkdown(ctx context.Context, title, content string) error {
+	msg := message{
+		MsgType: "interactive",
+		Card: &card{
+			Header:   header{Title: text{Tag: "plain_text", Content: title}, Template: "red"},
+			Elements: []element{{Tag: "markdown", Content: content}},
+		},
+	}
+	if r.secret != "" {
+		ts := r.now().Unix()
+		msg.Timestamp = strconv.FormatInt(ts, 10)
+		msg.Sign = Sign(ts, r.secret)
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("feishu returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("feishu: decode response: %v", err)
+	}
+	if res.Code != 0 {
+		return fmt.Errorf("feishu code %d: %s", res.Code, res.Msg)
+	}
+	return nil
+}
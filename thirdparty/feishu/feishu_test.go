@@ -0,0 +1,60 @@
+package feishu
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// 以 timestamp + "\n" + secret 为密钥对空串签名
+	if got := Sign(1599360473, "demo"); got != "l1N0gAcBjdwBvGm1xMjOF0XSyaLRpR7tuO5dHfhAYc8=" {
+		t.Fatalf("unexpected sign %s", got)
+	}
+}
+
+func TestSendMarkdown(t *testing.T) {
+	var got message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		var msg message
+		json.NewDecoder(r.Body).Decode(&msg)
+		ts, _ := strconv.ParseInt(msg.Timestamp, 10, 64)
+		// 签名校验失败时飞书仍返回HTTP 200
+		if msg.Sign != Sign(ts, "sec") {
+			w.Write([]byte(`{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`))
+			return
+		}
+		got = msg
+		w.Write([]byte(`{"code":0,"msg":"success"}`))
+	}))
+	defer srv.Close()
+
+	r := NewRobot(srv.URL+"/open-apis/bot/v2/hook/x", "sec")
+	r.now = func() time.Time { return time.Unix(1599360473, 0) }
+	if err := r.SendMarkdown(context.Background(), "OOM", "**ops/demo** [下载](http://x)"); err != nil {
+		t.Fatal(err)
+	}
+	if got.MsgType != "interactive" || got.Timestamp != "1599360473" || got.Card == nil ||
+		got.Card.Header.Title.Content != "OOM" || len(got.Card.Elements) != 1 ||
+		got.Card.Elements[0].Tag != "markdown" || got.Card.Elements[0].Content != "**ops/demo** [下载](http://x)" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	err := NewRobot(srv.URL+"/open-apis/bot/v2/hook/x", "wrong").SendMarkdown(context.Background(), "OOM", "x")
+	if err == nil || !strings.Contains(err.Error(), "19021") {
+		t.Fatalf("expected code error, got %v", err)
+	}
+	err = NewRobot(srv.URL+"/down", "").SendMarkdown(context.Background(), "OOM", "x")
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("expected HTTP status error, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadDownwardAPI 读取downward API卷，不需要访问API server的权限。
+// 文件名约定：labels、annotations(metadata.labels/annotations)，name、namespace、uid、
+// node_name(spec.nodeName)，以及可选的cpu_limit、memory_limit等resourceFieldRef，
+// 不存在的文件跳过
+func ReadDownwardAPI(dir string) (*Pod, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	pod := &Pod{}
+	var err error
+	if pod.Metadata.Labels, err = readMapFile(filepath.Join(dir, "labels")); err != nil {
+		return nil, err
+	}
+	if pod.Metadata.Annotations, err = readMapFile(filepath.Join(dir, "annotations")); err != nil {
+		return nil, err
+	}
+	fields := map[string]*string{
+		"name":      &pod.Metadata.Name,
+		"namespace": &pod.Metadata.Namespace,
+		"uid":       &pod.Metadata.UID,
+		"node_name": &pod.Spec.NodeName,
+	}
+	for name, v := range fields {
+		if *v, err = readFile(filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+	}
+	limits := map[string]string{}
+	for _, res := range []string{"cpu", "memory"} {
+		v, err := readFile(filepath.Join(dir, res+"_limit"))
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			limits[res] = v
+		}
+	}
+	if len(limits) > 0 {
+		pod.Spec.Containers = []Container{{Resources: Resources{Limits: limits}}}
+	}
+	return pod, nil
+}
+
+func readFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// readMapFile 每行一个 key="value"，value按Go字符串转义
+func readMapFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%s: bad line %q", path, line)
+		}
+		v, err := strconv.Unquote(line[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad value of %s: %v", path, line[:i], err)
+		}
+		m[line[:i]] = v
+	}
+	return m, sc.Err()
+}
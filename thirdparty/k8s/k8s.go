@@ -0,0 +1,216 @@
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// 只用到了core/v1 Pod的少数字段，不引入client-go
+// 文档: https://kubernetes.io/docs/reference/kubernetes-api/workload-resources/pod-v1/
+
+// OwnerReference 控制器信息
+type OwnerReference struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Controller bool   `json:"controller"`
+}
+
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	UID             string            `json:"uid"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+	OwnerReferences []OwnerReference  `json:"ownerReferences"`
+}
+
+type Resources struct {
+	Limits   map[string]string `json:"limits"`
+	Requests map[string]string `json:"requests"`
+}
+
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"` // valueFrom引用的值读不到，为空
+}
+
+type Container struct {
+	Name      string    `json:"name"`
+	Image     string    `json:"image"`
+	Env       []EnvVar  `json:"env"`
+	Resources Resources `json:"resources"`
+}
+
+// EnvValue 容器中直接配置了值的环境变量
+func (c Container) EnvValue(name string) string {
+	for _, e := range c.Env {
+		if e.Name == name {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+type ContainerStatus struct {
+	Name         string `json:"name"`
+	Image        string `json:"image"`
+	ImageID      string `json:"imageID"`
+	ContainerID  string `json:"containerID"` // containerd://<id>
+	RestartCount int    `json:"restartCount"`
+}
+
+type PodSpec struct {
+	NodeName   string      `json:"nodeName"`
+	Containers []Container `json:"containers"`
+}
+
+type PodStatus struct {
+	Phase             string            `json:"phase"`
+	HostIP            string            `json:"hostIP"`
+	PodIP             string            `json:"podIP"`
+	ContainerStatuses []ContainerStatus `json:"containerStatuses"`
+}
+
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+	Status   PodStatus  `json:"status"`
+}
+
+// Controller 控制器类型的ownerReference，没有时返回nil
+func (p *Pod) Controller() *OwnerReference {
+	for i, o := range p.Metadata.OwnerReferences {
+		if o.Controller {
+			return &p.Metadata.OwnerReferences[i]
+		}
+	}
+	return nil
+}
+
+// ContainerName 按容器id(不带runtime前缀)找到容器名，找不到时为空
+func (p *Pod) ContainerName(id string) string {
+	for _, cs := range p.Status.ContainerStatuses {
+		if i := strings.Index(cs.ContainerID, "://"); id != "" && i >= 0 && cs.ContainerID[i+3:] == id {
+			return cs.Name
+		}
+	}
+	return ""
+}
+
+// 集群内ServiceAccount的挂载目录
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Client 访问API server的pod接口
+type Client struct {
+	host   string // https://10.0.0.1:443
+	token  string
+	client *http.Client
+}
+
+func NewClient(host, token string, client *http.Client) *Client {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{host: strings.TrimSuffix(host, "/"), token: token, client: client}
+}
+
+// InClusterClient 使用pod的ServiceAccount访问API server，需要get pods权限
+func InClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a kubernetes cluster, KUBERNETES_SERVICE_HOST/PORT not set")
+	}
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("%s/ca.crt: no certificates", serviceAccountDir)
+	}
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	return NewClient("https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(token)), client), nil
+}
+
+// InClusterNamespace pod所在的namespace，依次取POD_NAMESPACE环境变量、ServiceAccount的namespace文件
+func InClusterNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	data, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// get 请求API server并解析JSON结果
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.host+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		// 错误时返回的是Status对象
+		var st struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &st)
+		return fmt.Errorf("returned HTTP status %s: %s", resp.Status, st.Message)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// GetPod GET /api/v1/namespaces/{namespace}/pods/{name}
+func (c *Client) GetPod(ctx context.Context, namespace, name string) (*Pod, error) {
+	pod := &Pod{}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(namespace), url.PathEscape(name))
+	if err := c.get(ctx, path, pod); err != nil {
+		return nil, fmt.Errorf("get pod %s/%s: %v", namespace, name, err)
+	}
+	return pod, nil
+}
+
+// ListNodePods 节点上所有namespace的pod，GET /api/v1/pods?fieldSelector=spec.nodeName=<node>，需要list pods权限
+func (c *Client) ListNodePods(ctx context.Context, node string) ([]Pod, error) {
+	var list struct {
+		Items []Pod `json:"items"`
+	}
+	q := url.Values{"fieldSelector": {"spec.nodeName=" + node}}
+	if err := c.get(ctx, "/api/v1/pods?"+q.Encode(), &list); err != nil {
+		return nil, fmt.Errorf("list pods on node %s: %v", node, err)
+	}
+	return list.Items, nil
+}
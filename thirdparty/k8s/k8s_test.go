@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const podJSON = `{
+  "metadata": {
+    "name": "ops-demo-7d9f8c6b5-x2kzq", "namespace": "ops", "uid": "u-1",
+    "labels": {"app.kubernetes.io/name": "demo"},
+    "annotations": {"dump-handler.io/notify": "ops-ding"},
+    "ownerReferences": [{"kind": "ReplicaSet", "name": "ops-demo-7d9f8c6b5", "controller": true}]
+  },
+  "spec": {"nodeName": "node-1", "containers": [{"name": "app", "image": "demo:1.0", "resources": {"limits": {"memory": "2Gi"}}}]},
+  "status": {"hostIP": "10.0.0.1", "containerStatuses": [{"name": "app", "containerID": "containerd://abc123", "restartCount": 3}]}
+}`
+
+func TestGetPod(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"kind":"Status","message":"Unauthorized"}`))
+			return
+		}
+		if r.URL.Path != "/api/v1/namespaces/ops/pods/ops-demo-7d9f8c6b5-x2kzq" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","message":"pods not found"}`))
+			return
+		}
+		w.Write([]byte(podJSON))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "tok", srv.Client())
+	pod, err := c.GetPod(context.Background(), "ops", "ops-demo-7d9f8c6b5-x2kzq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Spec.NodeName != "node-1" || pod.Controller().Name != "ops-demo-7d9f8c6b5" ||
+		pod.Spec.Containers[0].Resources.Limits["memory"] != "2Gi" || pod.Status.ContainerStatuses[0].RestartCount != 3 ||
+		pod.ContainerName("abc123") != "app" || pod.ContainerName("def") != "" {
+		t.Fatalf("got %+v", pod)
+	}
+	if _, err := c.GetPod(context.Background(), "ops", "missing"); err == nil {
+		t.Fatal("expected not found")
+	}
+	if _, err := NewClient(srv.URL, "bad", srv.Client()).GetPod(context.Background(), "ops", "x"); err == nil {
+		t.Fatal("expected unauthorized")
+	}
+}
+
+func TestReadDownwardAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"labels":       "app=\"demo\"\npod-template-hash=\"7d9f8c6b5\"\n",
+		"annotations":  "dump-handler.io/notify=\"ops-ding\"\nnote=\"a \\\"quoted\\\" value\"\n",
+		"namespace":    "ops\n",
+		"node_name":    "node-1",
+		"memory_limit": "2147483648",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pod, err := ReadDownwardAPI(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Metadata.Labels["app"] != "demo" || pod.Metadata.Annotations["note"] != `a "quoted" value` ||
+		pod.Metadata.Namespace != "ops" || pod.Spec.NodeName != "node-1" || pod.Metadata.Name != "" ||
+		pod.Spec.Containers[0].Resources.Limits["memory"] != "2147483648" {
+		t.Fatalf("got %+v", pod)
+	}
+}
+
+func TestNodePods(t *testing.T) {
+	lists := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/pods" || r.URL.Query().Get("fieldSelector") != "spec.nodeName=node-1" {
+			http.NotFound(w, r)
+			return
+		}
+		lists++
+		w.Write([]byte(`{"items": [` + podJSON + `]}`))
+	}))
+	defer srv.Close()
+
+	n := NewNodePods(NewClient(srv.URL, "", srv.Client()), "node-1", time.Hour)
+	for i := 0; i < 2; i++ {
+		pod, err := n.Get(context.Background(), "u-1")
+		if err != nil || pod == nil || pod.Metadata.Name != "ops-demo-7d9f8c6b5-x2kzq" {
+			t.Fatalf("got %+v %v", pod, err)
+		}
+	}
+	if pod, err := n.Get(context.Background(), "u-2"); err != nil || pod != nil {
+		t.Fatalf("unknown uid: %+v %v", pod, err)
+	}
+	// 第二次命中缓存，未知的uid刷新一次
+	if lists != 2 {
+		t.Fatalf("listed %d times", lists)
+	}
+}
+
+func TestKubeletDir(t *testing.T) {
+	dir := t.TempDir()
+	vol := filepath.Join(dir, "pods", "u-1", "volumes", "kubernetes.io~empty-dir", "dumps")
+	os.MkdirAll(vol, 0755)
+	hosts := "# Kubernetes-managed hosts file.\n127.0.0.1\tlocalhost\n::1\tlocalhost ip6-localhost\n10.1.2.3\tops-demo-0\n"
+	ioutil.WriteFile(filepath.Join(dir, "pods", "u-1", "etc-hosts"), []byte(hosts), 0644)
+
+	if dirs, _ := filepath.Glob(EmptyDirGlob(dir)); len(dirs) != 1 || dirs[0] != vol {
+		t.Fatalf("glob: %v", dirs)
+	}
+	if uid, ok := PodUID(dir, filepath.Join(vol, "oom")); !ok || uid != "u-1" {
+		t.Fatalf("uid: %s", uid)
+	}
+	if _, ok := PodUID(dir, "/tmp/oom"); ok {
+		t.Fatal("path outside kubelet dir")
+	}
+	if name := EtcHostsName(dir, "u-1"); name != "ops-demo-0" {
+		t.Fatalf("etc-hosts: %s", name)
+	}
+}
@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKubeletDir kubelet的--root-dir
+const DefaultKubeletDir = "/var/lib/kubelet"
+
+// EmptyDirGlob 所有pod的emptyDir卷: <kubelet>/pods/<uid>/volumes/kubernetes.io~empty-dir/<卷名>
+func EmptyDirGlob(kubeletDir string) string {
+	return filepath.Join(kubeletDir, "pods", "*", "volumes", "kubernetes.io~empty-dir", "*")
+}
+
+// PodUID 从kubelet目录下的文件路径取pod的UID
+func PodUID(kubeletDir, path string) (string, bool) {
+	rel, err := filepath.Rel(filepath.Join(kubeletDir, "pods"), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	uid := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+	return uid, uid != "" && uid != "."
+}
+
+// EtcHostsName kubelet为pod生成的hosts文件中最后一条记录的主机名，一般就是pod名；
+// API server不可用或pod已删除时用来兜底，hostNetwork的pod没有该文件
+func EtcHostsName(kubeletDir, uid string) string {
+	data, err := ioutil.ReadFile(filepath.Join(kubeletDir, "pods", uid, "etc-hosts"))
+	if err != nil {
+		return ""
+	}
+	name := ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		name = fields[1]
+	}
+	return name
+}
+
+// NodePods 按UID查找节点上的pod，从API server消失的pod继续缓存retain时长，
+// 因为emptyDir在pod删除后还要等kubelet回收
+type NodePods struct {
+	client *Client
+	node   string
+	retain time.Duration
+
+	mu   sync.Mutex
+	pods map[string]*Pod
+	seen map[string]time.Time
+}
+
+func NewNodePods(client *Client, node string, retain time.Duration) *NodePods {
+	return &NodePods{client: client, node: node, retain: retain, pods: map[string]*Pod{}, seen: map[string]time.Time{}}
+}
+
+// Refresh 重新列出节点上的pod
+func (n *NodePods) Refresh(ctx context.Context) error {
+	pods, err := n.client.ListNodePods(ctx, n.node)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := range pods {
+		uid := pods[i].Metadata.UID
+		n.pods[uid] = &pods[i]
+		n.seen[uid] = now
+	}
+	for uid, t := range n.seen {
+		if now.Sub(t) > n.retain {
+			delete(n.pods, uid)
+			delete(n.seen, uid)
+		}
+	}
+	return nil
+}
+
+// Get 缓存中没有时刷新一次再查
+func (n *NodePods) Get(ctx context.Context, uid string) (*Pod, error) {
+	n.mu.Lock()
+	pod, ok := n.pods[uid]
+	n.mu.Unlock()
+	if ok {
+		return pod, nil
+	}
+	if err := n.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.pods[uid], nil
+}
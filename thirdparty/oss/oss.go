@@ -0,0 +1,271 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dump-handler/thirdparty/storage"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+const metaPrefix = "x-oss-meta-"
+
+func init() {
+	storage.Register("oss", newBackend)
+}
+
+// 解析ossURL，支持两种写法:
+//
+//	oss://<bucket>.<endpoint>，如 oss://release.oss-cn-beijing.aliyuncs.com
+//	oss://<bucket>?endpoint=http://127.0.0.1:9000，用于内网或本地调试的endpoint
+func parseURL(ossURL string) (endpoint, bucket string, err error) {
+	u, err := url.Parse(ossURL)
+	if err != nil {
+		return "", "", err
+	}
+	if ep := u.Query().Get("endpoint"); ep != "" {
+		if u.Host == "" {
+			return "", "", fmt.Errorf("oss url %q has no bucket", ossURL)
+		}
+		return ep, u.Host, nil
+	}
+	i := strings.Index(u.Host, ".")
+	if i <= 0 || i == len(u.Host)-1 {
+		return "", "", fmt.Errorf("oss url %q should be oss://<bucket>.<endpoint>", ossURL)
+	}
+	return "https://" + u.Host[i+1:], u.Host[:i], nil
+}
+
+func newBucket(ossURL, secretID, secretKey string) (*oss.Bucket, error) {
+	endpoint, bucketName, err := parseURL(ossURL)
+	if err != nil {
+		return nil, err
+	}
+	c, err := oss.New(endpoint, secretID, secretKey, oss.Timeout(10, 100))
+	if err != nil {
+		return nil, err
+	}
+	return c.Bucket(bucketName)
+}
+
+func DownloadOSSBucket(ossURL, secretID, secretKey, fileName string) (io.ReadCloser, error) {
+	b, err := newBucket(ossURL, secretID, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return b.GetObject(fileName)
+}
+
+func Upload(ossURL, secretID, secretKey, fileName string, file io.Reader) error {
+	b, err := newBucket(ossURL, secretID, secretKey)
+	if err != nil {
+		return err
+	}
+	return b.PutObject(fileName, file)
+}
+
+// UploadFile 分片上传本地文件，checkpoint文件记录已完成的分片，进程重启后从断点继续
+func UploadFile(ossURL, secretID, secretKey, fileName, localPath string, partSize int64, routines int) error {
+	b, err := NewBackend(ossURL, storage.Credential{SecretID: secretID, SecretKey: secretKey})
+	if err != nil {
+		return err
+	}
+	return storage.UploadFileMultipart(context.Background(), b, b.URL(), fileName, localPath,
+		&storage.PutOptions{PartSize: partSize, Workers: routines})
+}
+
+// Backend 阿里云OSS实现的storage.Backend
+type Backend struct {
+	ossURL string
+	bucket *oss.Bucket
+}
+
+func newBackend(u *url.URL, cred storage.Credential) (storage.Backend, error) {
+	return NewBackend(u.String(), cred)
+}
+
+// NewBackend 使用oss://形式的地址创建后端
+func NewBackend(ossURL string, cred storage.Credential) (*Backend, error) {
+	b, err := newBucket(ossURL, cred.SecretID, cred.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{ossURL: ossURL, bucket: b}, nil
+}
+
+func putOptions(opts *storage.PutOptions) []oss.Option {
+	var options []oss.Option
+	if opts == nil {
+		return options
+	}
+	if opts.ContentType != "" {
+		options = append(options, oss.ContentType(opts.ContentType))
+	}
+	if opts.ContentEncoding != "" {
+		options = append(options, oss.ContentEncoding(opts.ContentEncoding))
+	}
+	for k, v := range opts.Metadata {
+		options = append(options, oss.Meta(k, v))
+	}
+	return options
+}
+
+func isNotFound(err error) bool {
+	se, ok := err.(oss.ServiceError)
+	return ok && se.StatusCode == http.StatusNotFound
+}
+
+func (b *Backend) Put(ctx context.Context, key string, r io.Reader, opts *storage.PutOptions) error {
+	options := append(putOptions(opts), oss.WithContext(ctx))
+	if opts != nil && opts.Size > 0 {
+		options = append(options, oss.ContentLength(opts.Size))
+	}
+	return b.bucket.PutObject(key, r, options...)
+}
+
+func (b *Backend) InitiateMultipartUpload(ctx context.Context, key string, opts *storage.PutOptions) (string, error) {
+	imur, err := b.bucket.InitiateMultipartUpload(key, append(putOptions(opts), oss.WithContext(ctx))...)
+	if err != nil {
+		return "", err
+	}
+	return imur.UploadID, nil
+}
+
+func (b *Backend) imur(key, uploadID string) oss.InitiateMultipartUploadResult {
+	return oss.InitiateMultipartUploadResult{Bucket: b.bucket.BucketName, Key: key, UploadID: uploadID}
+}
+
+func (b *Backend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	part, err := b.bucket.UploadPart(b.imur(key, uploadID), bytes.NewReader(data), int64(len(data)), partNumber, oss.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+func (b *Backend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.Part) error {
+	ps := make([]oss.UploadPart, 0, len(parts))
+	for _, p := range parts {
+		ps = append(ps, oss.UploadPart{PartNumber: p.PartNumber, ETag: p.ETag})
+	}
+	_, err := b.bucket.CompleteMultipartUpload(b.imur(key, uploadID), ps, oss.WithContext(ctx))
+	return err
+}
+
+func (b *Backend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	err := b.bucket.AbortMultipartUpload(b.imur(key, uploadID), oss.WithContext(ctx))
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *Backend) ListMultipartUploads(ctx context.Context, prefix string) ([]storage.Upload, error) {
+	var list []storage.Upload
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		res, err := b.bucket.ListMultipartUploads(oss.Prefix(prefix), oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIDMarker), oss.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range res.Uploads {
+			list = append(list, storage.Upload{Key: u.Key, UploadID: u.UploadID, Initiated: u.Initiated})
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		keyMarker, uploadIDMarker = res.NextKeyMarker, res.NextUploadIDMarker
+	}
+}
+
+func (b *Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := b.bucket.GetObject(key, oss.WithContext(ctx))
+	if isNotFound(err) {
+		return nil, storage.ErrNotExist
+	}
+	return r, err
+}
+
+func (b *Backend) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	h, err := b.bucket.GetObjectDetailedMeta(key, oss.WithContext(ctx))
+	if isNotFound(err) {
+		return nil, storage.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &storage.ObjectInfo{
+		Key:             key,
+		ETag:            strings.Trim(h.Get("ETag"), `"`),
+		ContentType:     h.Get("Content-Type"),
+		ContentEncoding: h.Get("Content-Encoding"),
+		Metadata:        make(map[string]string),
+	}
+	fmt.Sscanf(h.Get("Content-Length"), "%d", &info.Size)
+	if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+	for k := range h {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, metaPrefix) {
+			info.Metadata[strings.TrimPrefix(lk, metaPrefix)] = h.Get(k)
+		}
+	}
+	return info, nil
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var list []storage.ObjectInfo
+	marker := ""
+	for {
+		res, err := b.bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000), oss.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Objects {
+			list = append(list, storage.ObjectInfo{
+				Key:          o.Key,
+				Size:         o.Size,
+				ETag:         strings.Trim(o.ETag, `"`),
+				LastModified: o.LastModified,
+			})
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		marker = res.NextMarker
+	}
+}
+
+func (b *Backend) Delete(ctx context.Context, key string) error {
+	err := b.bucket.DeleteObject(key, oss.WithContext(ctx))
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *Backend) Presign(_ context.Context, key string, expire time.Duration) (string, error) {
+	return b.bucket.SignURL(key, oss.HTTPGet, int64(expire/time.Second))
+}
+
+func (b *Backend) URL() string {
+	endpoint, bucketName, _ := parseURL(b.ossURL)
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return b.ossURL
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		// IP形式的endpoint使用path-style
+		return fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, bucketName)
+	}
+	return fmt.Sprintf("%s://%s.%s", u.Scheme, bucketName, u.Host)
+}
@@ -0,0 +1,187 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dump-handler/thirdparty/storage"
+)
+
+// fakeOSS 本地的OSS替身，只实现上传下载用到的接口，path-style: /<bucket>/<key>
+type fakeOSS struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+func newFakeOSS() *fakeOSS {
+	return &fakeOSS{
+		objects: make(map[string][]byte),
+		headers: make(map[string]http.Header),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (f *fakeOSS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	q := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	_, initiate := q["uploads"]
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>b</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, key, id)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		parts := f.uploads[q.Get("uploadId")]
+		nums := make([]int, 0, len(parts))
+		for n := range parts {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		var buf bytes.Buffer
+		for _, n := range nums {
+			buf.Write(parts[n])
+		}
+		f.objects[key] = buf.Bytes()
+		f.headers[key] = r.Header.Clone()
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`, key)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.headers[key] = r.Header.Clone()
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"Error"`
+				Code    string
+			}{Code: "NoSuchKey"})
+			return
+		}
+		for k, v := range f.headers[key] {
+			if strings.HasPrefix(strings.ToLower(k), metaPrefix) {
+				w.Header()[k] = v
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestBackend(t *testing.T) (*Backend, *fakeOSS) {
+	fake := newFakeOSS()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	b, err := storage.New("oss://dumps?endpoint="+srv.URL, storage.Credential{SecretID: "id", SecretKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*Backend), fake
+}
+
+func TestPutGet(t *testing.T) {
+	b, _ := newTestBackend(t)
+	ctx := context.Background()
+	err := b.Put(ctx, "ka/env/jvm/pod", strings.NewReader("hprof"), &storage.PutOptions{Metadata: map[string]string{"codec": "gzip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := b.Get(ctx, "ka/env/jvm/pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "hprof" {
+		t.Fatalf("got %q", data)
+	}
+	info, err := b.Stat(ctx, "ka/env/jvm/pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || info.Metadata["codec"] != "gzip" {
+		t.Fatalf("unexpected stat %+v", info)
+	}
+	if _, err := b.Stat(ctx, "missing"); err != storage.ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestUploadPartCanceled(t *testing.T) {
+	// 服务端一直不响应，取消context后分片上传立即返回
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+	b, err := storage.New("oss://dumps?endpoint="+srv.URL, storage.Credential{SecretID: "id", SecretKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = b.(storage.Multipart).UploadPart(ctx, "big", "upload-1", 1, make([]byte, 1024))
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("upload part not canceled: %v after %v", err, time.Since(start))
+	}
+}
+
+func TestUploadFileMultipart(t *testing.T) {
+	b, fake := newTestBackend(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "oom")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 40*1024) // 640KB，分成7片
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := storage.PutFile(context.Background(), b, "ka/env/jvm/pod", path, &storage.PutOptions{PartSize: 100 * 1024, Workers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fake.objects["dumps/ka/env/jvm/pod"], data) {
+		t.Fatalf("object content mismatch, got %d bytes", len(fake.objects["dumps/ka/env/jvm/pod"]))
+	}
+	if _, err := os.Stat(path + ".cp"); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint file should be removed after success, err=%v", err)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	endpoint, bucket, err := parseURL("oss://release.oss-cn-beijing.aliyuncs.com")
+	if err != nil || endpoint != "https://oss-cn-beijing.aliyuncs.com" || bucket != "release" {
+		t.Fatalf("got %s %s %v", endpoint, bucket, err)
+	}
+	if _, _, err := parseURL("oss://release"); err == nil {
+		t.Fatal("expected error for url without endpoint")
+	}
+}
@@ -1,7 +1,11 @@
 package prom
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRead(t *testing.T) {
@@ -15,3 +19,118 @@ func TestRead(t *testing.T) {
 	pd.Init()
 	pd.QueryData(`avg(rate(node_cpu_seconds_total{mode="system"}[1m])) by (instance) *100`)
 }
+
+func TestFlush(t *testing.T) {
+	var got int64
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&got, 1)
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ok.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	pd := NewPromDataSource(Section{RemoteWrite: []RemoteConfig{
+		{Name: "ok", Url: ok.URL, RemoteTimeoutSecond: 5},
+		{Name: "bad", Url: bad.URL, RemoteTimeoutSecond: 5, RetryMaxAttempts: 1},
+	}})
+	if err := pd.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := pd.RemoteWrite([]MetricPoint{*NewMetricPoint("biz_oom_dump", map[string]string{"ka": "t"}, time.Now().Unix(), 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := pd.Close(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&got) != 3 {
+		t.Fatalf("expected 3 writes before Close returned, got %d", got)
+	}
+	if len(res) != 2 || !res[0].OK() || res[0].Sent != 3 || res[1].OK() || res[1].Failed != 3 || res[1].LastErr == nil {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+	if err := pd.RemoteWrite([]MetricPoint{*NewMetricPoint("biz_oom_dump", nil, time.Now().Unix(), 1)}); err == nil {
+		t.Fatal("expected error writing after Close")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt64(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	pd := NewPromDataSource(Section{RemoteWrite: []RemoteConfig{
+		{Name: "flaky", Url: srv.URL, RemoteTimeoutSecond: 5, RetryMaxAttempts: 3, RetryMinBackoffMs: 10, RetryMaxBackoffMs: 50},
+	}})
+	if err := pd.Init(); err != nil {
+		t.Fatal(err)
+	}
+	pd.RemoteWrite([]MetricPoint{*NewMetricPoint("biz_oom_dump", nil, time.Now().Unix(), 1)})
+	start := time.Now()
+	res, err := pd.Close(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res[0].OK() || atomic.LoadInt64(&calls) != 3 {
+		t.Fatalf("expected success on 3rd attempt, calls=%d results=%+v", calls, res)
+	}
+	// Retry-After被MaxBackoff截断
+	if time.Since(start) > time.Second {
+		t.Fatalf("Retry-After not capped by max backoff: %v", time.Since(start))
+	}
+}
+
+func TestRetryBoundedByClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// 默认重试策略总共会等待十几秒，Close只给1s
+	pd := NewPromDataSource(Section{RemoteWrite: []RemoteConfig{
+		{Name: "down", Url: srv.URL, RemoteTimeoutSecond: 5, RetryMaxAttempts: 10, RetryMinBackoffMs: 300, RetryMaxBackoffMs: 5000},
+	}})
+	if err := pd.Init(); err != nil {
+		t.Fatal(err)
+	}
+	pd.RemoteWrite([]MetricPoint{*NewMetricPoint("biz_oom_dump", nil, time.Now().Unix(), 1)})
+	start := time.Now()
+	res, _ := pd.Close(time.Second)
+	if time.Since(start) > 1500*time.Millisecond {
+		t.Fatalf("retries not bounded by close timeout: %v", time.Since(start))
+	}
+	if res[0].OK() {
+		t.Fatalf("expected failure, got %+v", res[0])
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := newRetryPolicy(RemoteConfig{RetryMinBackoffMs: 100, RetryMaxBackoffMs: 1000})
+	for attempt, want := range []time.Duration{0, 100, 200, 400, 800, 1000, 1000} {
+		if attempt == 0 {
+			continue
+		}
+		if got := p.backoff(attempt, 0); got != want*time.Millisecond {
+			t.Fatalf("attempt %d: got %v, want %v", attempt, got, want*time.Millisecond)
+		}
+	}
+	if got := p.backoff(1, 300*time.Millisecond); got != 300*time.Millisecond {
+		t.Fatalf("Retry-After ignored: %v", got)
+	}
+	if parseRetryAfter("2") != 2*time.Second || parseRetryAfter("junk") != 0 {
+		t.Fatal("parseRetryAfter")
+	}
+}
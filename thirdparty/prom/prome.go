@@ -1,9 +1,11 @@
 package prom
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/prometheus/common/model"
@@ -20,6 +22,12 @@ type RemoteConfig struct {
 	Env                 string `json:"env"`
 	Url                 string `json:"url"`
 	RemoteTimeoutSecond int    `json:"remote_timeout_second"`
+
+	// RecoverableError的重试策略，不配置时使用默认值
+	RetryMaxAttempts  int     `json:"retry_max_attempts"`
+	RetryMinBackoffMs int     `json:"retry_min_backoff_ms"`
+	RetryMaxBackoffMs int     `json:"retry_max_backoff_ms"`
+	RetryJitter       float64 `json:"retry_jitter"`
 }
 
 type Section struct {
@@ -34,6 +42,14 @@ type DataSource struct {
 	Queryable    storage.SampleAndChunkQueryable // 除了promql的查询，需要后端存储，如查询series
 	QueryEngine  *promql.Engine                  // promql相关查询
 	WriteTargets []*HttpClient                   // remote_write写入的后端地址
+
+	inflight sync.WaitGroup // 已入队但还没发送完的数据
+	stop     chan struct{}  // 关闭队列消费协程
+	closed   atomic.Bool
+
+	ctx      context.Context // Close超时后取消，中止还在重试的发送
+	cancel   context.CancelFunc
+	deadline atomic.Int64 // Close的截止时间(UnixNano)，重试等待不超过它
 }
 
 type HttpClient struct {
@@ -41,6 +57,11 @@ type HttpClient struct {
 	url        *url.URL
 	Client     *http.Client
 	timeout    time.Duration
+	retry      RetryPolicy
+
+	sent    atomic.Int64 // 发送成功的批次
+	failed  atomic.Int64 // 发送失败的批次
+	lastErr atomic.Error
 }
 
 type safePromQLNoStepSubqueryInterval struct {
@@ -61,7 +82,9 @@ func NewPromDataSource(cg Section) *DataSource {
 	pd := &DataSource{
 		Section:   cg,
 		PushQueue: make(chan []prompb.TimeSeries, 10000),
+		stop:      make(chan struct{}),
 	}
+	pd.ctx, pd.cancel = context.WithCancel(context.Background())
 	return pd
 }
 
@@ -164,6 +187,7 @@ func (pd *DataSource) Init() error {
 				url:        ur,
 				Client:     &http.Client{},
 				timeout:    time.Duration(u.RemoteTimeoutSecond) * time.Second,
+				retry:      newRetryPolicy(u),
 			})
 	}
 	pd.WriteTargets = writeTs
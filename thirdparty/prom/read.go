@@ -51,6 +51,10 @@ func timeParse(ts int64) time.Time {
 }
 
 func (pd *DataSource) CommonQuerySeries(qlStrFinal string) storage.SeriesSet {
+	if pd.Queryable == nil {
+		logger.Errorf("[prome_query_error][remote_read_not_initialized]")
+		return nil
+	}
 	matcherSets, err := parseMatchersParam([]string{qlStrFinal})
 	if err != nil {
 		logger.Errorf("[prome_query_error][parse_label_match_error][err:%+v]", err)
@@ -62,7 +66,8 @@ func (pd *DataSource) CommonQuerySeries(qlStrFinal string) storage.SeriesSet {
 	startT := millisecondTs(timeParse(tStart))
 	endT := millisecondTs(timeParse(tEnd))
 
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*30)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
 	q, err := pd.Queryable.Querier(ctx, startT, endT)
 	if err != nil {
 		logger.Errorf("[prome_query_error][get_querier_errro]")
@@ -88,6 +93,9 @@ func (pd *DataSource) CommonQuerySeries(qlStrFinal string) storage.SeriesSet {
 // 对应prometheus 中的 /api/v1/label/<label_name>/values
 func (pd *DataSource) QueryLabelValue(promql string, targetLabel string) []string {
 	s := pd.CommonQuerySeries(promql)
+	if s == nil {
+		return nil
+	}
 	if s.Warnings() != nil {
 		logger.Warningf("[prome_query_error][series_set_iter_error][warning:%+v]", s.Warnings())
 	}
@@ -129,6 +137,10 @@ func tsToUtcTs(s int64) time.Time {
 
 // 查询数据
 func (pd *DataSource) QueryData(qlStrFinal string) {
+	if pd.QueryEngine == nil || pd.Queryable == nil {
+		logger.Errorf("[prome_query_error][remote_read_not_initialized][args:%+v]", qlStrFinal)
+		return
+	}
 
 	tEnd := time.Now().Unix()
 	tStart := tEnd - 60*5
@@ -143,7 +155,8 @@ func (pd *DataSource) QueryData(qlStrFinal string) {
 		logger.Errorf("[prome_query_error][QueryData_error_may_be_parse_ql_error][args:%+v][err:%+v]", qlStrFinal, err)
 		return
 	}
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*30)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
 	res := q.Exec(ctx)
 	if res.Err != nil {
 		logger.Errorf("[prome_query_error][rangeQuery_exec_error][args:%+v][err:%+v]", qlStrFinal, res.Err)
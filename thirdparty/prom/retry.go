@@ -0,0 +1,113 @@
+package prom
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// 默认最多发送5次，退避从200ms开始每次翻倍，最长5s
+const (
+	DefaultRetryMaxAttempts  = 5
+	DefaultRetryMinBackoffMs = 200
+	DefaultRetryMaxBackoffMs = 5000
+)
+
+// RetryPolicy RecoverableError的重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 最多发送次数，包含第一次
+	MinBackoff  time.Duration // 第一次重试前的等待时间
+	MaxBackoff  time.Duration // 等待时间上限，Retry-After也不超过该值
+	Jitter      float64       // 等待时间上下浮动的比例，0~1
+}
+
+func newRetryPolicy(c RemoteConfig) RetryPolicy {
+	p := RetryPolicy{
+		MaxAttempts: c.RetryMaxAttempts,
+		MinBackoff:  time.Duration(c.RetryMinBackoffMs) * time.Millisecond,
+		MaxBackoff:  time.Duration(c.RetryMaxBackoffMs) * time.Millisecond,
+		Jitter:      c.RetryJitter,
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = DefaultRetryMinBackoffMs * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryMaxBackoffMs * time.Millisecond
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = p.MinBackoff
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		p.Jitter = 0
+	}
+	return p
+}
+
+// backoff 第attempt次失败后的等待时间，服务端给了Retry-After时优先使用
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if retryAfter > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return retryAfter
+	}
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// parseRetryAfter 支持秒数和HTTP日期两种格式
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// remoteWriteWithRetry RecoverableError按策略重试，其他错误直接返回。
+// Close之后等待时间超过截止时间的不再重试
+func (pd *DataSource) remoteWriteWithRetry(c *HttpClient, req []byte) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = remoteWritePost(pd.ctx, c, req)
+		if err == nil {
+			return nil
+		}
+		re, ok := err.(RecoverableError)
+		if !ok || attempt >= c.retry.MaxAttempts {
+			return err
+		}
+		wait := c.retry.backoff(attempt, re.retryAfter)
+		if d := pd.deadline.Load(); d > 0 && time.Now().Add(wait).UnixNano() >= d {
+			return fmt.Errorf("give up after %d attempts, next retry exceeds flush timeout: %v", attempt, err)
+		}
+		logger.Warningf("[prome_remote_write_retry][target:%s][attempt:%d/%d][wait:%v][err:%v]",
+			c.remoteName, attempt, c.retry.MaxAttempts, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-pd.ctx.Done():
+			return fmt.Errorf("canceled after %d attempts: %v", attempt, err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -30,9 +31,13 @@ func (pd *DataSource) remoteWrite() {
 			payload, err := pd.buildWriteRequest(pbItems)
 			if err != nil {
 				logger.Errorf("[prome_remote_write_error][pb_marshal_error][items: %+v][pb.err: %v]: ", pbItems, err)
+				pd.inflight.Done()
 				continue
 			}
 			pd.processWrite(payload)
+			pd.inflight.Done()
+		case <-pd.stop:
+			return
 		}
 
 	}
@@ -40,23 +45,91 @@ func (pd *DataSource) remoteWrite() {
 
 type RecoverableError struct {
 	error
+	retryAfter time.Duration // 429时服务端要求的等待时间
 }
 
 func (pd *DataSource) processWrite(payload []byte) {
 	for _, c := range pd.WriteTargets {
 		newC := c
+		pd.inflight.Add(1)
 		go func(cc *HttpClient, payload []byte) {
-			err := remoteWritePost(cc, payload)
+			defer pd.inflight.Done()
+			err := pd.remoteWriteWithRetry(cc, payload)
 			if err != nil {
+				cc.failed.Inc()
+				cc.lastErr.Store(err)
 				logger.Errorf("send prome finally fail: %v", err)
 				return
 			}
+			cc.sent.Inc()
 			// logger.Infof("send to prom %s ok", cc.url.String())
 		}(newC, payload)
 	}
 }
 
-func remoteWritePost(c *HttpClient, req []byte) error {
+// TargetResult 单个remote write目标的发送统计
+type TargetResult struct {
+	Name    string
+	Url     string
+	Sent    int64 // 发送成功的批次
+	Failed  int64 // 发送失败的批次
+	LastErr error // 最近一次失败的原因
+}
+
+// OK 没有失败且至少成功发送过一次
+func (r TargetResult) OK() bool {
+	return r.Failed == 0 && r.Sent > 0
+}
+
+// Results 各目标到目前为止的发送统计
+func (pd *DataSource) Results() []TargetResult {
+	res := make([]TargetResult, 0, len(pd.WriteTargets))
+	for _, c := range pd.WriteTargets {
+		res = append(res, TargetResult{
+			Name:    c.remoteName,
+			Url:     c.url.String(),
+			Sent:    c.sent.Load(),
+			Failed:  c.failed.Load(),
+			LastErr: c.lastErr.Load(),
+		})
+	}
+	return res
+}
+
+// Flush 等待PushQueue中已入队的数据全部发送到所有WriteTargets，
+// 超过timeout返回错误，无论是否超时都返回各目标的发送统计
+func (pd *DataSource) Flush(timeout time.Duration) ([]TargetResult, error) {
+	done := make(chan struct{})
+	go func() {
+		pd.inflight.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return pd.Results(), nil
+	case <-timer.C:
+		return pd.Results(), fmt.Errorf("[prome_flush_timeout][queued:%d][timeout:%v]", len(pd.PushQueue), timeout)
+	}
+}
+
+// Close Flush之后停止队列消费协程，之后的RemoteWrite返回错误。
+// 重试不会超过timeout，到期后还没发完的请求被取消
+func (pd *DataSource) Close(timeout time.Duration) ([]TargetResult, error) {
+	if !pd.closed.CAS(false, true) {
+		return pd.Results(), nil
+	}
+	pd.deadline.Store(time.Now().Add(timeout).UnixNano())
+	t := time.AfterFunc(timeout, pd.cancel)
+	defer t.Stop()
+	res, err := pd.Flush(timeout)
+	close(pd.stop)
+	pd.cancel()
+	return res, err
+}
+
+func remoteWritePost(ctx context.Context, c *HttpClient, req []byte) error {
 	httpReq, err := http.NewRequest("POST", c.url.String(), bytes.NewReader(req))
 	if err != nil {
 		// Errors from NewRequest are from unparsable URLs, so are not
@@ -68,7 +141,7 @@ func remoteWritePost(c *HttpClient, req []byte) error {
 	httpReq.Header.Set("Content-Type", "application/x-protobuf")
 	httpReq.Header.Set("User-Agent", "n9e-v5")
 	httpReq.Header.Set("X-theus-Remote-Write-Version", "0.1.0")
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
 	httpReq = httpReq.WithContext(ctx)
@@ -88,7 +161,7 @@ func remoteWritePost(c *HttpClient, req []byte) error {
 	if err != nil {
 		// Errors from Client.Do are from (for example) network errors, so are
 		// recoverable.
-		return RecoverableError{err}
+		return RecoverableError{error: err}
 	}
 	defer func() {
 		io.Copy(ioutil.Discard, httpResp.Body)
@@ -112,7 +185,10 @@ func remoteWritePost(c *HttpClient, req []byte) error {
 	}
 
 	if httpResp.StatusCode/100 == 5 {
-		return RecoverableError{err}
+		return RecoverableError{error: err}
+	}
+	if httpResp.StatusCode == http.StatusTooManyRequests {
+		return RecoverableError{error: err, retryAfter: parseRetryAfter(httpResp.Header.Get("Retry-After"))}
 	}
 	return err
 }
@@ -150,10 +226,14 @@ func (pd *DataSource) RemoteWrite(items []MetricPoint) error {
 	if len(items) == 0 {
 		return nil
 	}
+	if pd.closed.Load() {
+		return errors.New("prome datasource closed")
+	}
 	tsList, err := convertMany(items)
 	if err != nil {
 		return err
 	}
+	pd.inflight.Add(1)
 	pd.PushQueue <- tsList
 	return nil
 }
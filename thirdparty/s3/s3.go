@@ -0,0 +1,469 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dump-handler/thirdparty/storage"
+)
+
+const (
+	metaPrefix = "x-amz-meta-"
+	// DefaultPartSize 默认分片大小，S3要求除最后一片外不小于5MB
+	DefaultPartSize = 16 * 1024 * 1024
+	MinPartSize     = 5 * 1024 * 1024
+	defaultRegion   = "us-east-1"
+)
+
+func init() {
+	storage.Register("s3", newBackend)
+}
+
+// Error S3返回的错误
+type Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3: status %d, code %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Config S3兼容存储的连接参数
+type Config struct {
+	Endpoint  string // 如 https://s3.ap-northeast-1.amazonaws.com、http://minio:9000
+	Region    string
+	Bucket    string
+	PathStyle bool // MinIO、Ceph RGW通常需要path-style
+	AccessKey string
+	SecretKey string
+}
+
+// ParseURL 解析 s3://<bucket>?endpoint=http://minio:9000&region=us-east-1&path_style=true
+// 未指定endpoint时使用AWS的 https://s3.<region>.amazonaws.com
+func ParseURL(u *url.URL) (Config, error) {
+	cfg := Config{Bucket: u.Host}
+	if cfg.Bucket == "" {
+		return cfg, fmt.Errorf("s3 target %q has no bucket", u.String())
+	}
+	q := u.Query()
+	cfg.Region = q.Get("region")
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+	cfg.Endpoint = q.Get("endpoint")
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	if ps := q.Get("path_style"); ps != "" {
+		b, err := strconv.ParseBool(ps)
+		if err != nil {
+			return cfg, fmt.Errorf("s3 target %q: invalid path_style: %v", u.String(), err)
+		}
+		cfg.PathStyle = b
+	}
+	return cfg, nil
+}
+
+func newBackendFromURL(s3URL, secretID, secretKey string) (*Backend, error) {
+	u, err := url.Parse(s3URL)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseURL(u)
+	if err != nil {
+		return nil, err
+	}
+	cfg.AccessKey, cfg.SecretKey = secretID, secretKey
+	return NewBackend(cfg)
+}
+
+func DownloadS3Bucket(s3URL, secretID, secretKey, fileName string) (io.ReadCloser, error) {
+	b, err := newBackendFromURL(s3URL, secretID, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return b.Get(context.Background(), fileName)
+}
+
+func Upload(s3URL, secretID, secretKey, fileName string, file io.Reader) error {
+	b, err := newBackendFromURL(s3URL, secretID, secretKey)
+	if err != nil {
+		return err
+	}
+	return b.Put(context.Background(), fileName, file, nil)
+}
+
+// Backend S3兼容存储(AWS S3、MinIO、Ceph RGW)实现的storage.Backend
+type Backend struct {
+	cfg      Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newBackend(u *url.URL, cred storage.Credential) (storage.Backend, error) {
+	return newBackendFromURL(u.String(), cred.SecretID, cred.SecretKey)
+}
+
+func NewBackend(cfg Config) (*Backend, error) {
+	ep, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Scheme == "" || ep.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint %q should be like https://host[:port]", cfg.Endpoint)
+	}
+	return &Backend{
+		cfg:      cfg,
+		endpoint: ep,
+		client:   &http.Client{Transport: storage.NewTransport()},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL 按寻址方式拼接对象地址，key为空时是bucket地址
+func (b *Backend) objectURL(key string, query url.Values) *url.URL {
+	u := &url.URL{Scheme: b.endpoint.Scheme, Host: b.endpoint.Host}
+	path := "/" + strings.TrimPrefix(key, "/")
+	if b.cfg.PathStyle {
+		path = "/" + b.cfg.Bucket + path
+	} else {
+		u.Host = b.cfg.Bucket + "." + b.endpoint.Host
+	}
+	u.Path = path
+	u.RawPath = uriEncode(path, true)
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+	return u
+}
+
+// do 发送签名请求，body整体参与签名，非2xx的响应转换成*Error
+func (b *Backend) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = int64(len(body))
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	signRequest(req, b.cfg.AccessKey, b.cfg.SecretKey, b.cfg.Region, sha256Hex(body), b.now())
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, parseError(resp)
+	}
+	return resp, nil
+}
+
+func parseError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if len(data) > 0 {
+		xml.Unmarshal(data, e)
+	}
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+func drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func putHeader(opts *storage.PutOptions) http.Header {
+	h := make(http.Header)
+	if opts == nil {
+		return h
+	}
+	if opts.ContentType != "" {
+		h.Set("Content-Type", opts.ContentType)
+	}
+	if opts.ContentEncoding != "" {
+		h.Set("Content-Encoding", opts.ContentEncoding)
+	}
+	for k, v := range opts.Metadata {
+		h.Set(metaPrefix+k, v)
+	}
+	return h
+}
+
+// Put 小于一个分片的内容直接PUT，否则走分片上传
+// 分片按顺序从r中读出，内存中最多缓存一个分片，适合未知长度的流
+func (b *Backend) Put(ctx context.Context, key string, r io.Reader, opts *storage.PutOptions) error {
+	partSize := int64(DefaultPartSize)
+	if opts != nil && opts.PartSize > 0 {
+		partSize = opts.PartSize
+	}
+	if partSize < MinPartSize {
+		partSize = MinPartSize
+	}
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		resp, err := b.do(ctx, http.MethodPut, key, nil, putHeader(opts), buf[:n])
+		if err != nil {
+			return err
+		}
+		drain(resp)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	uploadID, err := b.InitiateMultipartUpload(ctx, key, opts)
+	if err != nil {
+		return err
+	}
+	var parts []storage.Part
+	for partNumber := 1; n > 0; partNumber++ {
+		etag, err := b.UploadPart(ctx, key, uploadID, partNumber, buf[:n])
+		if err != nil {
+			b.AbortMultipartUpload(context.Background(), key, uploadID)
+			return err
+		}
+		parts = append(parts, storage.Part{PartNumber: partNumber, ETag: etag})
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			b.AbortMultipartUpload(context.Background(), key, uploadID)
+			return err
+		}
+	}
+	if err := b.CompleteMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		b.AbortMultipartUpload(context.Background(), key, uploadID)
+		return err
+	}
+	return nil
+}
+
+// InitiateMultipartUpload 创建分片上传，返回uploadId
+func (b *Backend) InitiateMultipartUpload(ctx context.Context, key string, opts *storage.PutOptions) (string, error) {
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, putHeader(opts), nil)
+	if err != nil {
+		return "", err
+	}
+	defer drain(resp)
+	var res struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", err
+	}
+	if res.UploadID == "" {
+		return "", fmt.Errorf("s3: empty upload id for %s", key)
+	}
+	return res.UploadID, nil
+}
+
+// UploadPart 上传一个分片，返回ETag
+func (b *Backend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	q := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	resp, err := b.do(ctx, http.MethodPut, key, q, nil, data)
+	if err != nil {
+		return "", err
+	}
+	drain(resp)
+	return resp.Header.Get("ETag"), nil
+}
+
+// CompleteMultipartUpload 按分片号合并分片
+func (b *Backend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.Part) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+		Parts   []storage.Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	h := http.Header{"Content-Type": {"application/xml"}}
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, h, body)
+	if err != nil {
+		return err
+	}
+	defer drain(resp)
+	// S3在合并过程中出错时也可能返回200，错误信息在body里
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		e := &Error{StatusCode: resp.StatusCode}
+		xml.Unmarshal(data, e)
+		return e
+	}
+	return nil
+}
+
+// AbortMultipartUpload 放弃分片上传，释放已上传的分片
+func (b *Backend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+// ListMultipartUploads 列出prefix下未完成的分片上传
+func (b *Backend) ListMultipartUploads(ctx context.Context, prefix string) ([]storage.Upload, error) {
+	var list []storage.Upload
+	q := url.Values{"uploads": {""}, "prefix": {prefix}}
+	for {
+		resp, err := b.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			IsTruncated        bool   `xml:"IsTruncated"`
+			NextKeyMarker      string `xml:"NextKeyMarker"`
+			NextUploadIDMarker string `xml:"NextUploadIdMarker"`
+			Uploads            []struct {
+				Key       string    `xml:"Key"`
+				UploadID  string    `xml:"UploadId"`
+				Initiated time.Time `xml:"Initiated"`
+			} `xml:"Upload"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		drain(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range res.Uploads {
+			list = append(list, storage.Upload{Key: u.Key, UploadID: u.UploadID, Initiated: u.Initiated})
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		q.Set("key-marker", res.NextKeyMarker)
+		q.Set("upload-id-marker", res.NextUploadIDMarker)
+	}
+}
+
+func (b *Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if isNotFound(err) {
+		return nil, storage.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *Backend) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if isNotFound(err) {
+		return nil, storage.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	drain(resp)
+	info := &storage.ObjectInfo{
+		Key:             key,
+		Size:            resp.ContentLength,
+		ETag:            strings.Trim(resp.Header.Get("ETag"), `"`),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		Metadata:        make(map[string]string),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+	for k := range resp.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, metaPrefix) {
+			info.Metadata[strings.TrimPrefix(lk, metaPrefix)] = resp.Header.Get(k)
+		}
+	}
+	return info, nil
+}
+
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func (b *Backend) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var list []storage.ObjectInfo
+	q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := b.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		drain(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Contents {
+			list = append(list, storage.ObjectInfo{
+				Key:          o.Key,
+				Size:         o.Size,
+				ETag:         strings.Trim(o.ETag, `"`),
+				LastModified: o.LastModified,
+			})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return list, nil
+		}
+		q.Set("continuation-token", res.NextContinuationToken)
+	}
+}
+
+func (b *Backend) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+func (b *Backend) Presign(_ context.Context, key string, expire time.Duration) (string, error) {
+	return presignURL(b.objectURL(key, nil), b.cfg.AccessKey, b.cfg.SecretKey, b.cfg.Region, expire, b.now()), nil
+}
+
+func (b *Backend) URL() string {
+	u := b.objectURL("", nil)
+	return strings.TrimSuffix(u.String(), "/")
+}
@@ -0,0 +1,150 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+	shortDateFormat = "20060102"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode 按SigV4的规则编码，只保留 A-Z a-z 0-9 - _ . ~
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, false)+"="+uriEncode(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// 参与签名的header：host、content-type、content-md5、range以及所有x-amz-*
+func canonicalHeaders(req *http.Request) (canonical, signed string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "content-md5" || lk == "range" {
+			headers[lk] = strings.TrimSpace(strings.Join(vs, ","))
+		}
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + ":" + headers[k] + "\n")
+	}
+	return b.String(), strings.Join(keys, ";")
+}
+
+func scope(t time.Time, region string) string {
+	return fmt.Sprintf("%s/%s/s3/aws4_request", t.Format(shortDateFormat), region)
+}
+
+func signingKey(secretKey, region string, t time.Time) []byte {
+	k := hmacSHA256([]byte("AWS4"+secretKey), t.Format(shortDateFormat))
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, "s3")
+	return hmacSHA256(k, "aws4_request")
+}
+
+func stringToSign(t time.Time, region, canonicalRequest string) string {
+	return strings.Join([]string{
+		signAlgorithm,
+		t.Format(amzDateFormat),
+		scope(t, region),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+}
+
+// signRequest 使用SigV4给请求签名，payloadHash为body的sha256或UNSIGNED-PAYLOAD
+func signRequest(req *http.Request, accessKey, secretKey, region, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	ch, signed := canonicalHeaders(req)
+	cr := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, true),
+		canonicalQuery(req.URL.Query()),
+		ch,
+		signed,
+		payloadHash,
+	}, "\n")
+	sig := hex.EncodeToString(hmacSHA256(signingKey(secretKey, region, t), stringToSign(t, region, cr)))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, accessKey, scope(t, region), signed, sig))
+}
+
+// presignURL 生成query-string形式签名的GET地址
+func presignURL(u *url.URL, accessKey, secretKey, region string, expire time.Duration, t time.Time) string {
+	t = t.UTC()
+	pu := *u
+	q := pu.Query()
+	q.Set("X-Amz-Algorithm", signAlgorithm)
+	q.Set("X-Amz-Credential", accessKey+"/"+scope(t, region))
+	q.Set("X-Amz-Date", t.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", fmt.Sprintf("%d", int64(expire/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+	cr := strings.Join([]string{
+		http.MethodGet,
+		uriEncode(pu.Path, true),
+		canonicalQuery(q),
+		"host:" + pu.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	sig := hex.EncodeToString(hmacSHA256(signingKey(secretKey, region, t), stringToSign(t, region, cr)))
+	pu.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + sig
+	return pu.String()
+}
@@ -0,0 +1,53 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Webhook Slack incoming webhook
+// 文档: https://api.slack.com/messaging/webhooks
+type Webhook struct {
+	url    string // https://hooks.slack.com/services/T000/B000/XXXX
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type message struct {
+	Text string `json:"text"`
+}
+
+// Send 发送mrkdwn格式的文本，链接写作<url|文字>
+func (w *Webhook) Send(ctx context.Context, text string) error {
+	body, err := json.Marshal(message{Text: text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 成功时返回200和"ok"，出错时返回4xx和错误原因，如invalid_token、no_text
+	if resp.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,42 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	var got message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/T000/B000/XXXX" {
+			// Slack出错时返回4xx和纯文本的错误原因
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("invalid_token"))
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid_payload"))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL+"/services/T000/B000/XXXX").Send(context.Background(), "*OOM* <http://x|dump>"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "*OOM* <http://x|dump>" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	err := NewWebhook(srv.URL+"/services/wrong").Send(context.Background(), "x")
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "invalid_token") {
+		t.Fatalf("expected HTTP status error, got %v", err)
+	}
+}
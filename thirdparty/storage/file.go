@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("file", newFileBackend)
+}
+
+// FileBackend 本地目录(或挂载的NFS/PVC)后端，file:///data/dumps
+// 不支持自定义元数据
+type FileBackend struct {
+	root string
+}
+
+func newFileBackend(u *url.URL, _ Credential) (Backend, error) {
+	root := filepath.Join(u.Host, u.Path)
+	if root == "" {
+		return nil, fmt.Errorf("file storage target %q has empty path", u.String())
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FileBackend{root: root}, nil
+}
+
+// path 对象在root下的路径，key由pod名、注解、模板拼成，带".."跳出root时报错
+func (b *FileBackend) path(key string) (string, error) {
+	p := filepath.Join(b.root, filepath.FromSlash(strings.TrimPrefix(key, "/")))
+	rel, err := filepath.Rel(b.root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object key %q: outside of %s", key, b.root)
+	}
+	return p, nil
+}
+
+func (b *FileBackend) Put(_ context.Context, key string, r io.Reader, _ *PutOptions) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再rename，避免读到写了一半的对象
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (b *FileBackend) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+func (b *FileBackend) Stat(_ context.Context, key string) (*ObjectInfo, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}, nil
+}
+
+func (b *FileBackend) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	var list []ObjectInfo
+	err := filepath.Walk(b.root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			list = append(list, ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()})
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (b *FileBackend) Delete(_ context.Context, key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *FileBackend) Presign(_ context.Context, key string, _ time.Duration) (string, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String(), nil
+}
+
+func (b *FileBackend) URL() string {
+	return (&url.URL{Scheme: "file", Path: b.root}).String()
+}
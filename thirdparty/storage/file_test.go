@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileBackendKeyEscape(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	b, err := New("file://"+root, Credential{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := b.Put(ctx, "/ka/env/jvm/../jvm/pod", strings.NewReader("x"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(ctx, "ka/env/jvm/pod"); err != nil {
+		t.Fatalf("cleaned key not stored under root: %v", err)
+	}
+	// pod名、注解带".."时不能写到root外面
+	for _, key := range []string{"../evil", "ka/../../evil", "", ".."} {
+		if err := b.Put(ctx, key, bytes.NewReader(nil), nil); err == nil {
+			t.Fatalf("%q: expected error", key)
+		}
+		if _, err := b.Get(ctx, key); err == nil {
+			t.Fatalf("%q: get expected error", key)
+		}
+		if err := b.Delete(ctx, key); err == nil {
+			t.Fatalf("%q: delete expected error", key)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("files written outside root: %v", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+		t.Fatal("evil written")
+	}
+}
@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+const (
+	// DefaultPartSize 默认分片大小
+	DefaultPartSize = 16 * 1024 * 1024
+	// DefaultWorkers 默认并发上传的分片数
+	DefaultWorkers = 4
+	// MaxParts 单个对象最多的分片数(S3/COS/OSS均为10000)
+	MaxParts = 10000
+	// MinPartSize 除最后一片外的最小分片，S3为5MB，更小的分片全部上传后在CompleteMultipartUpload时才失败
+	MinPartSize = 5 * 1024 * 1024
+)
+
+// minPartSize 实际使用的下限，测试中调小
+var minPartSize int64 = MinPartSize
+
+// partSize 默认值和下限
+func partSize(size int64) int64 {
+	if size <= 0 {
+		return DefaultPartSize
+	}
+	if size < minPartSize {
+		return minPartSize
+	}
+	return size
+}
+
+// Part 已上传的分片
+type Part struct {
+	PartNumber int    `json:"part_number" xml:"PartNumber"`
+	ETag       string `json:"etag" xml:"ETag"`
+}
+
+// Upload 未完成的分片上传
+type Upload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// Multipart 支持分片上传的后端
+type Multipart interface {
+	InitiateMultipartUpload(ctx context.Context, key string, opts *PutOptions) (string, error)
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+	ListMultipartUploads(ctx context.Context, prefix string) ([]Upload, error)
+}
+
+// Checkpoint 断点文件内容，记录上传到哪个对象以及已完成的分片
+type Checkpoint struct {
+	Target   string `json:"target"`
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id"`
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mod_time"`
+	PartSize int64  `json:"part_size"`
+	Parts    []Part `json:"parts"`
+}
+
+// CheckpointPath 本地文件对应的断点文件，放在文件旁边
+func CheckpointPath(path string) string {
+	return path + ".cp"
+}
+
+// LoadCheckpoint 读取断点文件，文件不存在时返回nil
+func LoadCheckpoint(cpPath string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(cpPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint %s: %v", cpPath, err)
+	}
+	return cp, nil
+}
+
+// ResumeKey 本地文件有未完成的上传时返回当时使用的对象名，
+// 重启后的进程用它代替新生成的带时间后缀的对象名，才能接着上传
+func ResumeKey(path, target string) (string, bool) {
+	cp, err := LoadCheckpoint(CheckpointPath(path))
+	if err != nil || cp == nil || cp.Target != target {
+		return "", false
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() != cp.Size || fi.ModTime().UnixNano() != cp.ModTime {
+		return "", false
+	}
+	return cp.Key, true
+}
+
+// CheckpointUploadIDs 匹配glob的断点文件中正在进行的上传，清理残留上传时排除
+func CheckpointUploadIDs(glob string) []string {
+	paths, _ := filepath.Glob(glob)
+	var ids []string
+	for _, p := range paths {
+		if cp, err := LoadCheckpoint(p); err == nil && cp != nil && cp.UploadID != "" {
+			ids = append(ids, cp.UploadID)
+		}
+	}
+	return ids
+}
+
+func (cp *Checkpoint) save(cpPath string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再rename，进程被kill时不会留下半个断点文件
+	tmp := cpPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cpPath)
+}
+
+func (cp *Checkpoint) done() map[int]Part {
+	m := make(map[int]Part, len(cp.Parts))
+	for _, p := range cp.Parts {
+		m[p.PartNumber] = p
+	}
+	return m
+}
+
+// UploadFileMultipart 分片并发上传本地文件，每完成一个分片就更新断点文件，
+// 进程重启后对同一文件再次调用会跳过已完成的分片；上传成功后删除断点文件
+func UploadFileMultipart(ctx context.Context, m Multipart, target, key, path string, opts *PutOptions) error {
+	o := PutOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.PartSize = partSize(o.PartSize)
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	// 分片数超过上限时放大分片
+	for (size+o.PartSize-1)/o.PartSize > MaxParts {
+		o.PartSize *= 2
+	}
+
+	cpPath := CheckpointPath(path)
+	cp, err := LoadCheckpoint(cpPath)
+	if err != nil {
+		logger.Warningf("[multipart][ignore_bad_checkpoint][path:%s][err:%v]", cpPath, err)
+		cp = nil
+	}
+	if cp != nil && (cp.Target != target || cp.Key != key || cp.Size != size ||
+		cp.ModTime != fi.ModTime().UnixNano() || cp.PartSize != o.PartSize) {
+		// 文件或目标变了，旧的上传不能续传，放弃掉避免残留分片占用存储
+		logger.Infof("[multipart][discard_stale_checkpoint][key:%s][upload_id:%s]", cp.Key, cp.UploadID)
+		if cp.Target == target {
+			if err := m.AbortMultipartUpload(ctx, cp.Key, cp.UploadID); err != nil {
+				logger.Warningf("[multipart][abort_stale_upload_error][key:%s][err:%v]", cp.Key, err)
+			}
+		}
+		cp = nil
+	}
+	if cp == nil {
+		uploadID, err := m.InitiateMultipartUpload(ctx, key, &o)
+		if err != nil {
+			return err
+		}
+		cp = &Checkpoint{
+			Target:   target,
+			Key:      key,
+			UploadID: uploadID,
+			Size:     size,
+			ModTime:  fi.ModTime().UnixNano(),
+			PartSize: o.PartSize,
+		}
+		if err := cp.save(cpPath); err != nil {
+			return err
+		}
+	} else {
+		logger.Infof("[multipart][resume][key:%s][upload_id:%s][done_parts:%d]", cp.Key, cp.UploadID, len(cp.Parts))
+	}
+
+	total := int((size + o.PartSize - 1) / o.PartSize)
+	if total == 0 {
+		total = 1
+	}
+	done := cp.done()
+	todo := make(chan int, total)
+	for n := 1; n <= total; n++ {
+		if _, ok := done[n]; !ok {
+			todo <- n
+		}
+	}
+	close(todo)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan Part)
+	errs := make(chan error, o.Workers)
+	var wg sync.WaitGroup
+	for w := 0; w < o.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, o.PartSize)
+			for n := range todo {
+				off := int64(n-1) * o.PartSize
+				length := o.PartSize
+				if off+length > size {
+					length = size - off
+				}
+				if _, err := f.ReadAt(buf[:length], off); err != nil {
+					errs <- fmt.Errorf("read part %d: %v", n, err)
+					cancel()
+					return
+				}
+				etag, err := m.UploadPart(ctx, cp.Key, cp.UploadID, n, buf[:length])
+				if err != nil {
+					errs <- fmt.Errorf("upload part %d: %v", n, err)
+					cancel()
+					return
+				}
+				select {
+				case results <- Part{PartNumber: n, ETag: etag}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	for p := range results {
+		cp.Parts = append(cp.Parts, p)
+		if err := cp.save(cpPath); err != nil {
+			logger.Warningf("[multipart][save_checkpoint_error][path:%s][err:%v]", cpPath, err)
+		}
+	}
+	select {
+	case err := <-errs:
+		// 保留断点文件，下次从这里继续
+		return err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sort.Slice(cp.Parts, func(i, j int) bool { return cp.Parts[i].PartNumber < cp.Parts[j].PartNumber })
+	if err := m.CompleteMultipartUpload(ctx, cp.Key, cp.UploadID, cp.Parts); err != nil {
+		return err
+	}
+	os.Remove(cpPath)
+	return nil
+}
+
+// AbortOrphanUploads 放弃prefix下发起时间早于olderThan的分片上传，
+// 本地断点文件里正在续传的上传通过keep排除
+func AbortOrphanUploads(ctx context.Context, m Multipart, prefix string, olderThan time.Duration, keep ...string) (int, error) {
+	uploads, err := m.ListMultipartUploads(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	skip := make(map[string]struct{}, len(keep))
+	for _, id := range keep {
+		skip[id] = struct{}{}
+	}
+	deadline := time.Now().Add(-olderThan)
+	aborted := 0
+	var failed []string
+	for _, u := range uploads {
+		if _, ok := skip[u.UploadID]; ok || u.Initiated.After(deadline) {
+			continue
+		}
+		if err := m.AbortMultipartUpload(ctx, u.Key, u.UploadID); err != nil {
+			failed = append(failed, fmt.Sprintf("%s(%s): %v", u.Key, u.UploadID, err))
+			continue
+		}
+		aborted++
+	}
+	if len(failed) > 0 {
+		return aborted, fmt.Errorf("abort uploads failed: %s", strings.Join(failed, "; "))
+	}
+	return aborted, nil
+}
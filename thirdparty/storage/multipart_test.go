@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memMultipart 内存中的分片上传，failPart指定的分片第一次上传会失败
+type memMultipart struct {
+	mu       sync.Mutex
+	nextID   int
+	parts    map[string]map[int][]byte
+	uploaded []int
+	objects  map[string][]byte
+	aborted  []string
+	failPart int
+}
+
+func newMemMultipart() *memMultipart {
+	return &memMultipart{parts: make(map[string]map[int][]byte), objects: make(map[string][]byte)}
+}
+
+func (m *memMultipart) InitiateMultipartUpload(_ context.Context, key string, _ *PutOptions) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	id := fmt.Sprintf("id-%d", m.nextID)
+	m.parts[id] = make(map[int][]byte)
+	return id, nil
+}
+
+func (m *memMultipart) UploadPart(_ context.Context, _, uploadID string, n int, data []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n == m.failPart {
+		m.failPart = 0
+		return "", errors.New("connection reset")
+	}
+	m.parts[uploadID][n] = append([]byte(nil), data...)
+	m.uploaded = append(m.uploaded, n)
+	return fmt.Sprintf("etag-%d", n), nil
+}
+
+func (m *memMultipart) CompleteMultipartUpload(_ context.Context, key, uploadID string, parts []Part) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var buf bytes.Buffer
+	for i, p := range parts {
+		if p.PartNumber != i+1 {
+			return fmt.Errorf("parts out of order: %v", parts)
+		}
+		buf.Write(m.parts[uploadID][p.PartNumber])
+	}
+	m.objects[key] = buf.Bytes()
+	delete(m.parts, uploadID)
+	return nil
+}
+
+func (m *memMultipart) AbortMultipartUpload(_ context.Context, _, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aborted = append(m.aborted, uploadID)
+	delete(m.parts, uploadID)
+	return nil
+}
+
+func (m *memMultipart) ListMultipartUploads(_ context.Context, _ string) ([]Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []Upload
+	for id := range m.parts {
+		list = append(list, Upload{Key: "k", UploadID: id, Initiated: time.Now().Add(-48 * time.Hour)})
+	}
+	return list, nil
+}
+
+func writeDump(t *testing.T, size int) (string, []byte) {
+	path := filepath.Join(t.TempDir(), "oom")
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestUploadFileMultipartResume(t *testing.T) {
+	path, data := writeDump(t, 10*1024+7)
+	m := newMemMultipart()
+	m.failPart = 6
+	opts := &PutOptions{PartSize: 1024, Workers: 1}
+
+	if err := UploadFileMultipart(context.Background(), m, "mem://", "dump", path, opts); err == nil {
+		t.Fatal("expected first upload to fail")
+	}
+	cp, err := LoadCheckpoint(CheckpointPath(path))
+	if err != nil || cp == nil {
+		t.Fatalf("checkpoint should be kept after failure, cp=%v err=%v", cp, err)
+	}
+	if key, ok := ResumeKey(path, "mem://"); !ok || key != "dump" {
+		t.Fatalf("ResumeKey got %q %v", key, ok)
+	}
+
+	m.uploaded = nil
+	if err := UploadFileMultipart(context.Background(), m, "mem://", "dump", path, opts); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(m.uploaded)
+	if len(m.uploaded) != 6 || m.uploaded[0] != 6 {
+		t.Fatalf("resume should only upload parts 6..11, got %v", m.uploaded)
+	}
+	if !bytes.Equal(m.objects["dump"], data) {
+		t.Fatal("object content mismatch")
+	}
+	if _, err := os.Stat(CheckpointPath(path)); !os.IsNotExist(err) {
+		t.Fatal("checkpoint should be removed after success")
+	}
+}
+
+func TestUploadFileMultipartStaleCheckpoint(t *testing.T) {
+	path, data := writeDump(t, 4096)
+	m := newMemMultipart()
+	stale := &Checkpoint{Target: "mem://", Key: "old", UploadID: "stale", Size: 1, PartSize: 1024}
+	if err := stale.save(CheckpointPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	if err := UploadFileMultipart(context.Background(), m, "mem://", "dump", path, &PutOptions{PartSize: 1024, Workers: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.aborted) != 1 || m.aborted[0] != "stale" {
+		t.Fatalf("stale upload should be aborted, got %v", m.aborted)
+	}
+	if !bytes.Equal(m.objects["dump"], data) {
+		t.Fatal("object content mismatch")
+	}
+}
+
+func TestAbortOrphanUploads(t *testing.T) {
+	m := newMemMultipart()
+	keep, _ := m.InitiateMultipartUpload(context.Background(), "k", nil)
+	m.InitiateMultipartUpload(context.Background(), "k", nil)
+	dir := t.TempDir()
+	(&Checkpoint{Key: "k", UploadID: keep}).save(filepath.Join(dir, "oom.cp"))
+	ioutil.WriteFile(filepath.Join(dir, "broken.cp"), []byte("{"), 0644)
+	ids := CheckpointUploadIDs(filepath.Join(dir, "*.cp"))
+	if len(ids) != 1 || ids[0] != keep {
+		t.Fatalf("checkpoint upload ids %v", ids)
+	}
+	n, err := AbortOrphanUploads(context.Background(), m, "", 24*time.Hour, ids...)
+	if err != nil || n != 1 {
+		t.Fatalf("aborted %d, err %v", n, err)
+	}
+	if _, ok := m.parts[keep]; !ok {
+		t.Fatal("upload in keep list should not be aborted")
+	}
+}
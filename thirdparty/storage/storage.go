@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotExist 对象不存在
+var ErrNotExist = errors.New("object does not exist")
+
+// ObjectInfo 对象元信息
+type ObjectInfo struct {
+	Key             string            `json:"key"`
+	Size            int64             `json:"size"`
+	ETag            string            `json:"etag"`
+	LastModified    time.Time         `json:"last_modified"`
+	ContentType     string            `json:"content_type"`
+	ContentEncoding string            `json:"content_encoding"`
+	Metadata        map[string]string `json:"metadata"`
+}
+
+// PutOptions 上传参数
+type PutOptions struct {
+	ContentType     string            // 对象的Content-Type
+	ContentEncoding string            // 对象的Content-Encoding
+	Size            int64             // 内容长度，未知时填-1
+	Metadata        map[string]string // 自定义元数据，各后端自行加前缀(x-cos-meta-、x-oss-meta-、x-amz-meta-)
+	PartSize        int64             // 分片大小，0表示使用后端默认值，小于MinPartSize时按MinPartSize
+	Workers         int               // 并发上传的分片数，0表示使用后端默认值
+}
+
+// Credential 访问后端所需的密钥
+type Credential struct {
+	SecretID  string
+	SecretKey string
+}
+
+// Backend 对象存储后端
+type Backend interface {
+	// Put 上传对象，r读取到EOF为止
+	Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) error
+	// Get 下载对象，调用方负责Close
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat 获取对象元信息，不存在时返回ErrNotExist
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List 列出prefix下的所有对象
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete 删除对象，对象不存在不算错误
+	Delete(ctx context.Context, key string) error
+	// Presign 生成带签名的临时下载地址
+	Presign(ctx context.Context, key string, expire time.Duration) (string, error)
+	// URL 后端的访问地址，用于告警中拼接下载链接
+	URL() string
+}
+
+// PutFile 上传本地文件，大于一个分片且后端支持Multipart时分片并发上传并支持断点续传，否则整体Put
+func PutFile(ctx context.Context, b Backend, key, path string, opts *PutOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	o := PutOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if m, ok := b.(Multipart); ok && fi.Size() > partSize(o.PartSize) {
+		return UploadFileMultipart(ctx, m, b.URL(), key, path, &o)
+	}
+	o.Size = fi.Size()
+	return b.Put(ctx, key, f, &o)
+}
+
+// Factory 根据目标地址创建后端
+type Factory func(u *url.URL, cred Credential) (Backend, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register 注册一个scheme对应的后端，通常在实现包的init中调用
+func Register(scheme string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if f == nil {
+		panic("storage: Register factory is nil")
+	}
+	if _, dup := factories[scheme]; dup {
+		panic("storage: Register called twice for scheme " + scheme)
+	}
+	factories[scheme] = f
+}
+
+// Schemes 已注册的scheme列表
+func Schemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	list := make([]string, 0, len(factories))
+	for scheme := range factories {
+		list = append(list, scheme)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// New 根据目标地址的scheme选择后端，如 cos://、oss://、s3://、file://
+func New(target string, cred Credential) (Backend, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parse storage target %q: %v", target, err)
+	}
+	factoriesMu.RLock()
+	f, ok := factories[u.Scheme]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage scheme %q, available: %v", u.Scheme, Schemes())
+	}
+	return f(u, cred)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// PutStream 上传长度未知的流(如边读边压缩的dump)，
+// 后端支持Multipart时按分片顺序读出并发上传，内存中最多缓存Workers+1个分片；
+// 流不足一个分片时直接Put。流式上传没有断点，失败后放弃已上传的分片
+func PutStream(ctx context.Context, b Backend, key string, r io.Reader, opts *PutOptions) error {
+	o := PutOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.PartSize = partSize(o.PartSize)
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+
+	first := make([]byte, o.PartSize)
+	n, err := io.ReadFull(r, first)
+	m, ok := b.(Multipart)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && !ok) {
+		o.Size = int64(n)
+		if err == nil {
+			// 后端不支持分片，剩下的内容接在后面一次性上传
+			o.Size = -1
+			return b.Put(ctx, key, io.MultiReader(bytes.NewReader(first), r), &o)
+		}
+		return b.Put(ctx, key, bytes.NewReader(first[:n]), &o)
+	}
+	if err != nil {
+		return err
+	}
+
+	uploadID, err := m.InitiateMultipartUpload(ctx, key, &o)
+	if err != nil {
+		return err
+	}
+	abort := func(cause error) error {
+		if err := m.AbortMultipartUpload(context.Background(), key, uploadID); err != nil {
+			return fmt.Errorf("%v (abort upload %s failed: %v)", cause, uploadID, err)
+		}
+		return cause
+	}
+
+	type job struct {
+		number int
+		data   []byte
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan job)
+	free := make(chan []byte, o.Workers+1)
+	for i := 0; i < o.Workers; i++ {
+		free <- make([]byte, o.PartSize)
+	}
+	var (
+		mu       sync.Mutex
+		parts    []Part
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < o.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				etag, err := m.UploadPart(ctx, key, uploadID, j.number, j.data)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("upload part %d: %v", j.number, err)
+					cancel()
+				}
+				if err == nil {
+					parts = append(parts, Part{PartNumber: j.number, ETag: etag})
+				}
+				mu.Unlock()
+				free <- j.data[:cap(j.data)]
+			}
+		}()
+	}
+
+	var readErr error
+	buf := first
+	for number := 1; n > 0; number++ {
+		if number > MaxParts {
+			readErr = fmt.Errorf("stream exceeds %d parts of %d bytes", MaxParts, o.PartSize)
+			break
+		}
+		select {
+		case jobs <- job{number: number, data: buf[:n]}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case buf = <-free:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			readErr = err
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if readErr != nil {
+		return abort(readErr)
+	}
+	if firstErr != nil {
+		return abort(firstErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return abort(err)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	if err := m.CompleteMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		return abort(err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+// 测试中用小分片
+func init() {
+	minPartSize = 1024
+}
+
+type memBackend struct {
+	*FileBackend
+	*memMultipart
+}
+
+func TestPutStream(t *testing.T) {
+	fb := &FileBackend{root: t.TempDir()}
+	m := newMemMultipart()
+	b := memBackend{fb, m}
+	ctx := context.Background()
+
+	// 不足一个分片时直接Put
+	if err := PutStream(ctx, b, "small", bytes.NewReader([]byte("tiny")), &PutOptions{PartSize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fb.Get(ctx, "small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(got) != "tiny" {
+		t.Fatalf("got %q", got)
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := PutStream(ctx, b, "big", bytes.NewReader(data), &PutOptions{PartSize: 1024, Workers: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.objects["big"], data) {
+		t.Fatal("object content mismatch")
+	}
+
+	m.failPart = 4
+	if err := PutStream(ctx, b, "fail", bytes.NewReader(data), &PutOptions{PartSize: 1024, Workers: 2}); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(m.aborted) != 1 || len(m.parts) != 0 {
+		t.Fatalf("failed stream upload should be aborted, aborted=%v pending=%d", m.aborted, len(m.parts))
+	}
+}
+
+func TestMinPartSize(t *testing.T) {
+	defer func(old int64) { minPartSize = old }(minPartSize)
+	minPartSize = 4096
+	m := newMemMultipart()
+	b := memBackend{&FileBackend{root: t.TempDir()}, m}
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	// 1024小于下限，按4096分片：10000字节分3片
+	if err := PutStream(context.Background(), b, "big", bytes.NewReader(data), &PutOptions{PartSize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.uploaded) != 3 || !bytes.Equal(m.objects["big"], data) {
+		t.Fatalf("expected 3 parts of 4096 bytes, uploaded %v", m.uploaded)
+	}
+}
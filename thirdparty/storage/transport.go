@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// NewTransport 对象存储客户端的Transport，只限制建连、TLS握手和等待响应头的时间，
+// 不限制读写body的总时长，多GB的dump上传下载由请求的context控制取消
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	}
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Webhook 通用的JSON webhook，把告警内容原样POST到url
+type Webhook struct {
+	url     string
+	headers map[string]string // 附加的请求头，如Authorization
+	client  *http.Client
+}
+
+func New(url string, headers map[string]string) *Webhook {
+	return &Webhook{url: url, headers: headers, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Post v序列化为JSON后POST，返回非2xx时报错
+func (w *Webhook) Post(ctx context.Context, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
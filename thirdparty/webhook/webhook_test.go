@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPost(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tk" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := New(srv.URL, map[string]string{"Authorization": "Bearer tk"})
+	if err := w.Post(context.Background(), map[string]string{"pod": "ops-demo", "key": "ka/env/jvm/ops-demo"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["pod"] != "ops-demo" || got["key"] != "ka/env/jvm/ops-demo" {
+		t.Fatalf("unexpected body: %v", got)
+	}
+
+	err := New(srv.URL, nil).Post(context.Background(), map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("expected HTTP status error, got %v", err)
+	}
+}
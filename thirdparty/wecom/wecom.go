@@ -0,0 +1,71 @@
+package wecom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Robot 企业微信群机器人
+// 文档: https://developer.work.weixin.qq.com/document/path/91770
+type Robot struct {
+	webhook string // https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=xxx
+	client  *http.Client
+}
+
+func NewRobot(webhook string) *Robot {
+	return &Robot{webhook: webhook, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type markdown struct {
+	Content string `json:"content"`
+}
+
+type message struct {
+	MsgType  string    `json:"msgtype"`
+	Markdown *markdown `json:"markdown"`
+}
+
+type response struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// SendMarkdown 发送markdown消息，企业微信的markdown没有标题字段，@成员用<@userid>写在正文里
+func (r *Robot) SendMarkdown(ctx context.Context, content string) error {
+	body, err := json.Marshal(message{MsgType: "markdown", Markdown: &markdown{Content: content}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("wecom returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("wecom: decode response: %v", err)
+	}
+	if res.ErrCode != 0 {
+		return fmt.Errorf("wecom errcode %d: %s", res.ErrCode, res.ErrMsg)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package wecom
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendMarkdown(t *testing.T) {
+	var got message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("key") {
+		case "ok":
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		case "invalid":
+			w.Write([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))
+		default:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	if err := NewRobot(srv.URL+"/cgi-bin/webhook/send?key=ok").SendMarkdown(context.Background(), "### OOM\n<@ops>"); err != nil {
+		t.Fatal(err)
+	}
+	if got.MsgType != "markdown" || got.Markdown == nil || got.Markdown.Content != "### OOM\n<@ops>" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	// HTTP 200也要检查errcode
+	err := NewRobot(srv.URL+"/cgi-bin/webhook/send?key=invalid").SendMarkdown(context.Background(), "x")
+	if err == nil || !strings.Contains(err.Error(), "93000") {
+		t.Fatalf("expected errcode error, got %v", err)
+	}
+	err = NewRobot(srv.URL+"/cgi-bin/webhook/send?key=down").SendMarkdown(context.Background(), "x")
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "bad gateway") {
+		t.Fatalf("expected HTTP status error, got %v", err)
+	}
+}
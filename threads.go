@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"dump-handler/logic"
+	"dump-handler/pkg/threaddump"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// captureThreads 每隔-thread-dump-interval抓取一次线程dump，共-thread-dump-count次，合并成一个对象上传；
+// pid为0时找本机(共享进程namespace的pod)中的java进程
+func captureThreads(ctx context.Context, d dump, pid int) error {
+	var err error
+	if pid == 0 {
+		if pid, err = threaddump.FindJVM(); err != nil {
+			return err
+		}
+	}
+	t, err := logic.ParseKeyTemplate(threadKeyTemplate)
+	if err != nil {
+		return fmt.Errorf("thread-key-template: %v", err)
+	}
+	u, err := prepare(d, codec, time.Now())
+	if u == nil || err != nil {
+		return err
+	}
+	opts := threaddump.Options{Jcmd: jcmdPath, Output: threadDumpOutput, Timeout: threadDumpTimeout, Settle: threaddump.DefaultOptions.Settle}
+	var buf bytes.Buffer
+	for i := 0; i < threadDumpCount; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(threadDumpInterval):
+			}
+		}
+		out, err := threaddump.Capture(ctx, pid, opts)
+		if err != nil {
+			logger.Errorf("[thread_dump][pid:%d][sample:%d][err:%v]", pid, i+1, err)
+			continue
+		}
+		logger.Infof("[thread_dump][pid:%d][sample:%d][size:%d]", pid, i+1, len(out))
+		buf.Write(out)
+		buf.WriteString("\n")
+		u.samples++
+	}
+	if u.samples == 0 {
+		return fmt.Errorf("no thread dump captured from pid %d", pid)
+	}
+	fileName, err := logic.RenderKey(t, u.info)
+	if err != nil {
+		return fmt.Errorf("render object key: %v", err)
+	}
+	size := int64(buf.Len())
+	key, err := logic.UploadStream(ctx, u.backend, fileName, &buf, u.opts)
+	if err != nil {
+		return fmt.Errorf("upload thread dump: %v", err)
+	}
+	u.finish(key, size, nil)
+	return nil
+}
+
+// 按需抓取线程dump，排查死锁、卡死: dump-handler threads -thread-dump-pid <JVM pid> -thread-dump-count 3
+func threads() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if threadWaitParent > 0 {
+		if err := waitParentExit(ctx, threadWaitParent); err != nil {
+			return err
+		}
+	}
+	return captureThreads(ctx, localDump(""), threadDumpPid)
+}
+
+// spawnThreadCapture OnOutOfMemoryError执行时VM线程在安全点持有Heap_lock，jcmd和SIGQUIT都要等安全点结束，
+// 不能在本进程中抓取。用相同的参数启动一个脱离会话的threads子进程，等本进程退出、JVM离开安全点后再抓取
+func spawnThreadCapture(pid int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	args := append([]string{"threads"}, os.Args[1:]...)
+	args = append(args, "-thread-dump-pid", strconv.Itoa(pid), "-thread-dump-wait-parent", strconv.Itoa(os.Getpid()))
+	cmd := exec.Command(exe, args...)
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start thread dump capturer: %v", err)
+	}
+	logger.Infof("[thread_dump][pid:%d][capturer:%d] capture after OnOutOfMemoryError returns", pid, cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+// waitParentExit 父进程退出后子进程被init或subreaper接管，ppid随之改变；
+// 父进程由参数传入，子进程启动前父进程已经退出时不用等待
+func waitParentExit(ctx context.Context, ppid int) error {
+	for os.Getppid() == ppid {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	return nil
+}